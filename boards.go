@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// rootBoardName is the board of the tasks of the root Taskfile in multi-board mode.
+const rootBoardName = "Taskfile"
+
+// namespaceEdge connects two namespaces, the root Taskfile being rootBoardName.
+type namespaceEdge struct {
+	From string
+	To   string
+}
+
+// GetCalledNamespace returns the namespace of the task called as name from the Taskfile of namespace,
+// false for the tasks of the same namespace and unknown tasks. Names starting with a colon
+// are relative to the root Taskfile, whose namespaces are rootIncludes.
+func (tf *Taskfile) GetCalledNamespace(namespace, name string, rootIncludes []string) (string, bool) {
+	if _, _, isLocalTask := tf.ResolveTaskName(name); isLocalTask {
+		return "", false
+	}
+	if rootName, isRootRelative := strings.CutPrefix(name, ":"); isRootRelative {
+		calledNamespace, _, isIncluded := strings.Cut(rootName, ":")
+		if !isIncluded || !slices.Contains(rootIncludes, calledNamespace) {
+			calledNamespace = rootBoardName
+		}
+		return calledNamespace, calledNamespace != namespace
+	}
+	if namespace != rootBoardName {
+		// Tasks of the Taskfiles included by an included Taskfile stay on its board
+		return "", false
+	}
+	calledNamespace, _, isIncluded := strings.Cut(name, ":")
+	return calledNamespace, isIncluded
+}
+
+// readIncludedTaskfile reads and parses the Taskfile included under namespace by the Taskfile at path,
+// at the git revision of the options if set.
+func readIncludedTaskfile(taskfile *Taskfile, path, namespace string, options *Options) (*Taskfile, error) {
+	dir := "."
+	if path != "-" {
+		dir = filepath.Dir(path)
+	}
+	includePath, isLocal := taskfile.GetIncludePath(dir, namespace)
+	if !isLocal {
+		return nil, fmt.Errorf("the Taskfile of %s is not a local file", namespace)
+	}
+	includeYaml, err := ReadTaskfileAtRevision(options.Revision, includePath)
+	if err != nil {
+		return nil, err
+	}
+	includedTaskfile, err := ParseTaskfile(includeYaml)
+	if err != nil {
+		return nil, fmt.Errorf("error processing %s: %w", includePath, err)
+	}
+	if options.Platform != "" {
+		includedTaskfile.FilterPlatform(ParsePlatform(options.Platform))
+	}
+	return includedTaskfile, nil
+}
+
+// getIncludedTask returns the task called as name in the Taskfile included under namespace,
+// if it was read for the current board.
+func (d *Diagram) getIncludedTask(namespace, name string) (*Task, bool) {
+	includedTaskfile, isRead := d.namespaceTaskfiles[namespace]
+	if !isRead {
+		return nil, false
+	}
+	taskName, _, isLocalTask := includedTaskfile.ResolveTaskName(name)
+	if !isLocalTask {
+		return nil, false
+	}
+	task := includedTaskfile.Tasks[taskName]
+	return &task, true
+}
+
+// WriteBoards writes an overview of the namespaces of the Taskfile at path, with the number of
+// calls between them. Each namespace links to a board of its own: the root Taskfile's tasks, and
+// the tasks of the included Taskfiles if they can be read, or else the tasks called in them.
+func (d *Diagram) WriteBoards(d2Writer *D2Writer, taskfile *Taskfile, path string) {
+	namespaces := taskfile.GetIncludes()
+	namespaceTaskfiles := map[string]*Taskfile{rootBoardName: taskfile}
+	calledTasks := make(map[string][]string)
+	for _, namespace := range namespaces {
+		includedTaskfile, err := readIncludedTaskfile(taskfile, path, namespace, d.options)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: only the called tasks of %s are drawn: %v\n", namespace, err)
+			continue
+		}
+		namespaceTaskfiles[namespace] = includedTaskfile
+	}
+
+	callCounts := make(map[namespaceEdge]int)
+	for _, namespace := range slices.Sorted(maps.Keys(namespaceTaskfiles)) {
+		for _, edge := range namespaceTaskfiles[namespace].GetEdges() {
+			if edge.Kind == RequiredVarEdge {
+				continue
+			}
+			calledNamespace, isOtherNamespace := namespaceTaskfiles[namespace].GetCalledNamespace(namespace, edge.To, namespaces)
+			if !isOtherNamespace {
+				continue
+			}
+			callCounts[namespaceEdge{namespace, calledNamespace}]++
+			if _, hasTaskfile := namespaceTaskfiles[calledNamespace]; !hasTaskfile && namespace == rootBoardName {
+				calledTask := strings.SplitN(edge.To, ":", 2)[1]
+				if !slices.Contains(calledTasks[calledNamespace], calledTask) {
+					calledTasks[calledNamespace] = append(calledTasks[calledNamespace], calledTask)
+				}
+			}
+			if !slices.Contains(namespaces, calledNamespace) && calledNamespace != rootBoardName {
+				namespaces = append(namespaces, calledNamespace)
+			}
+		}
+	}
+
+	rootLabel := rootBoardName
+	if path != "-" {
+		rootLabel = filepath.Base(path)
+	}
+	d2Writer.Write(fmt.Sprintf("'%s'", rootBoardName), fmt.Sprintf("%s {link: layers.%s}", Quote(rootLabel), rootBoardName))
+	for _, namespace := range namespaces {
+		d.markLegendEntry(includedTaskfileLegendEntry)
+		d2Writer.Write(fmt.Sprintf("'%s'", namespace), fmt.Sprintf("{link: layers.%s; icon: ${%s}}", namespace, includedTaskfileIconName))
+	}
+	for _, edge := range slices.SortedFunc(maps.Keys(callCounts), func(a, b namespaceEdge) int {
+		return strings.Compare(a.From+"\x00"+a.To, b.From+"\x00"+b.To)
+	}) {
+		label := "1 call"
+		if callCounts[edge] != 1 {
+			label = fmt.Sprintf("%d calls", callCounts[edge])
+		}
+		d2Writer.Write(fmt.Sprintf("'%s' -> '%s'", edge.From, edge.To), label)
+	}
+
+	for _, namespace := range slices.Concat([]string{rootBoardName}, namespaces) {
+		boardWriter := NewD2Writer()
+		boardWriter.Write(boardWriter.NewID(), "Overview {near: top-left; link: _}")
+		if namespaceTaskfile, hasTaskfile := namespaceTaskfiles[namespace]; hasTaskfile {
+			// The root Taskfile's board links its namespaces to their boards
+			if namespace == rootBoardName {
+				d.namespaceTaskfiles = namespaceTaskfiles
+			}
+			d.WriteTaskfile(boardWriter, namespaceTaskfile)
+			d.namespaceTaskfiles = nil
+		} else {
+			for _, calledTask := range calledTasks[namespace] {
+				d.markLegendEntry(unknownTaskLegendEntry)
+				boardWriter.Write(fmt.Sprintf("'%s'.icon", calledTask), fmt.Sprintf("${%s}", unknownTaskIconName))
+			}
+		}
+		WriteGlobalStyles(boardWriter)
+		d2Writer.Write(fmt.Sprintf("layers.%s", namespace), boardWriter.Block())
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteBoards(t *testing.T) {
+	dir := t.TempDir()
+	const docsYaml = `
+version: '3'
+tasks:
+  gen:
+    internal: true
+  serve:
+    cmds:
+      - task: gen
+`
+	if err := os.Mkdir(filepath.Join(dir, "docs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "docs", "Taskfile.yml"), []byte(docsYaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	const taskfileYaml = `
+version: '3'
+includes:
+  docs: ./docs
+tasks:
+  build:
+    cmds:
+      - task: docs:gen
+      - task: docs:serve
+      - task: docs:missing
+`
+	options := NewOptions()
+	options.Boards = true
+	d2, err := TaskfileToD2([]byte(taskfileYaml), filepath.Join(dir, "Taskfile.yml"), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"'docs'.link: _.layers.docs",
+		"'docs'.'gen'.icon: ${internalTaskIcon}",
+		"'docs'.'serve'.icon: ${externalTaskIcon}",
+		"'docs'.'missing'.icon: ${unknownTaskIcon}",
+	} {
+		if !strings.Contains(d2, want) {
+			t.Errorf("the diagram does not contain %q:\n%s", want, d2)
+		}
+	}
+	if count := strings.Count(d2, externalTaskIconName+":"); count != 1 {
+		t.Errorf("the icon variables are written %d times, want once in the root board", count)
+	}
+}
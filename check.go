@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around the changes of a unified diff.
+const diffContext = 3
+
+// errOutdated is returned by CheckOutput when the output file is not up to date.
+var errOutdated = errors.New("the diagram is not up to date, regenerate it")
+
+// splitLines splits text into lines keeping their line feed, the last line having none if the text
+// does not end with a line feed.
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLine is a line of a diff, prefixed with " ", "-" or "+".
+type diffLine struct {
+	prefix  string
+	text    string
+	oldLine int
+	newLine int
+}
+
+// diffLines returns the lines of oldLines and newLines as removed, added or unchanged,
+// following the longest common subsequence of both. The lines both start and end with are
+// trimmed before computing the subsequence, whose table is quadratic in the remaining lines.
+func diffLines(oldLines, newLines []string) (result []diffLine) {
+	prefix := 0
+	for prefix < len(oldLines) && prefix < len(newLines) && oldLines[prefix] == newLines[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(oldLines)-prefix && suffix < len(newLines)-prefix && oldLines[len(oldLines)-1-suffix] == newLines[len(newLines)-1-suffix] {
+		suffix++
+	}
+	for i := range prefix {
+		result = append(result, diffLine{" ", oldLines[i], i, i})
+	}
+	oldMiddle, newMiddle := oldLines[prefix:len(oldLines)-suffix], newLines[prefix:len(newLines)-suffix]
+	// common[i][j] is the length of the longest common subsequence of oldMiddle[i:] and newMiddle[j:]
+	common := make([][]int, len(oldMiddle)+1)
+	for i := range common {
+		common[i] = make([]int, len(newMiddle)+1)
+	}
+	for i := len(oldMiddle) - 1; i >= 0; i-- {
+		for j := len(newMiddle) - 1; j >= 0; j-- {
+			if oldMiddle[i] == newMiddle[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(oldMiddle) || j < len(newMiddle) {
+		switch {
+		case i < len(oldMiddle) && j < len(newMiddle) && oldMiddle[i] == newMiddle[j]:
+			result = append(result, diffLine{" ", oldMiddle[i], prefix + i, prefix + j})
+			i++
+			j++
+		case j == len(newMiddle) || (i < len(oldMiddle) && common[i+1][j] >= common[i][j+1]):
+			result = append(result, diffLine{"-", oldMiddle[i], prefix + i, prefix + j})
+			i++
+		default:
+			result = append(result, diffLine{"+", newMiddle[j], prefix + i, prefix + j})
+			j++
+		}
+	}
+	for k := range suffix {
+		oldLine, newLine := len(oldLines)-suffix+k, len(newLines)-suffix+k
+		result = append(result, diffLine{" ", oldLines[oldLine], oldLine, newLine})
+	}
+	return
+}
+
+// UnifiedDiff returns the differences between oldText and newText in the unified format of `diff -u`,
+// empty if they are equal.
+func UnifiedDiff(oldName, newName, oldText, newText string) string {
+	if oldText == newText {
+		return ""
+	}
+	lines := diffLines(splitLines(oldText), splitLines(newText))
+	var diff strings.Builder
+	fmt.Fprintf(&diff, "--- %s\n+++ %s\n", oldName, newName)
+	for start := 0; start < len(lines); {
+		if lines[start].prefix == " " {
+			start++
+			continue
+		}
+		// A hunk spans the changes separated by less than twice the context, with the context around them
+		end := start
+		for unchanged := 0; end < len(lines) && unchanged <= 2*diffContext; end++ {
+			if lines[end].prefix == " " {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+		}
+		for end > start && lines[end-1].prefix == " " {
+			end--
+		}
+		hunkStart, hunkEnd := max(start-diffContext, 0), min(end+diffContext, len(lines))
+		var oldCount, newCount int
+		for _, line := range lines[hunkStart:hunkEnd] {
+			if line.prefix != "+" {
+				oldCount++
+			}
+			if line.prefix != "-" {
+				newCount++
+			}
+		}
+		fmt.Fprintf(&diff, "@@ -%s +%s @@\n", hunkRange(lines[hunkStart].oldLine, oldCount), hunkRange(lines[hunkStart].newLine, newCount))
+		for _, line := range lines[hunkStart:hunkEnd] {
+			diff.WriteString(line.prefix + line.text)
+			if !strings.HasSuffix(line.text, "\n") {
+				diff.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		start = hunkEnd
+	}
+	return diff.String()
+}
+
+// hunkRange formats the 0-based start and the line count of a hunk as 1-based, as `diff -u` does.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// CheckOutput compares the diagram with the content of the output file at path, printing a unified diff
+// to the standard output and returning errOutdated if they differ.
+func CheckOutput(path string, d2 string) error {
+	if path == "-" {
+		return fmt.Errorf("--check compares with an output file, it can not be used with the standard output")
+	}
+	existing, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%s does not exist: %w", path, errOutdated)
+	}
+	if err != nil {
+		return err
+	}
+	diff := UnifiedDiff(path, path+" (generated)", string(existing), d2)
+	if diff == "" {
+		return nil
+	}
+	if _, err := os.Stdout.WriteString(diff); err != nil {
+		return fmt.Errorf("error writing output: %w", err)
+	}
+	return fmt.Errorf("%s: %w", path, errOutdated)
+}
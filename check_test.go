@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// numberLines returns the numbers from first to last, one per line.
+func numberLines(first, last int) string {
+	var lines strings.Builder
+	for number := first; number <= last; number++ {
+		fmt.Fprintf(&lines, "%d\n", number)
+	}
+	return lines.String()
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name    string
+		oldText string
+		newText string
+		want    string
+	}{
+		{"equal", "a\nb\n", "a\nb\n", ""},
+		{
+			name:    "separate hunks",
+			oldText: numberLines(1, 20),
+			newText: numberLines(1, 4) + "x\n" + numberLines(6, 15) + numberLines(17, 21),
+			want: "--- old\n+++ new\n" +
+				"@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+x\n 6\n 7\n 8\n" +
+				"@@ -13,8 +13,8 @@\n 13\n 14\n 15\n-16\n 17\n 18\n 19\n 20\n+21\n",
+		},
+		{
+			name:    "no newline at end of file",
+			oldText: "a\nb",
+			newText: "a\nc\n",
+			want:    "--- old\n+++ new\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n",
+		},
+		{
+			name:    "empty old text",
+			oldText: "",
+			newText: "a\n",
+			want:    "--- old\n+++ new\n@@ -0,0 +1 @@\n+a\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := UnifiedDiff("old", "new", test.oldText, test.newText); got != test.want {
+				t.Errorf("UnifiedDiff() =\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDiffLinesLargeText(t *testing.T) {
+	oldLines := splitLines(numberLines(1, 100000))
+	newLines := splitLines(numberLines(1, 50000) + "x\n" + numberLines(50001, 100000))
+	lines := diffLines(oldLines, newLines)
+	if len(lines) != 100001 || lines[50000] != (diffLine{"+", "x\n", 50000, 50000}) {
+		t.Errorf("diffLines() returned %d lines, want the insertion of x after 50000 among 100001 lines", len(lines))
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// configFileName is the name of the project configuration file, looked up next to the Taskfile.
+const configFileName = ".taskfile2d2.yml"
+
+// configIconNames maps the icon names of the configuration file to the D2 variables holding the icons.
+var configIconNames = map[string]string{
+	"externalTask":     externalTaskIconName,
+	"internalTask":     internalTaskIconName,
+	"unknownTask":      unknownTaskIconName,
+	"var":              varIconName,
+	"includedTaskfile": includedTaskfileIconName,
+}
+
+// Config is the project configuration file, so that every team member generates the same diagram.
+// Its settings apply to the flags that are not set on the command line.
+type Config struct {
+	// Format is the output format, d2 or svg
+	Format  string `yaml:"format"`
+	Filters struct {
+		Platform string   `yaml:"platform"`
+		Exclude  []string `yaml:"exclude"`
+	} `yaml:"filters"`
+	ExpandLoops    *bool  `yaml:"expandLoops"`
+	VarsLayer      *bool  `yaml:"varsLayer"`
+	VarsProvenance *bool  `yaml:"varsProvenance"`
+	Layout         string `yaml:"layout"`
+	// Direction is the direction of the diagram: up, down, left or right
+	Direction string `yaml:"direction"`
+	Pad       *int   `yaml:"pad"`
+	Grid      struct {
+		Rows    *int `yaml:"rows"`
+		Columns *int `yaml:"columns"`
+		Gap     *int `yaml:"gap"`
+	} `yaml:"grid"`
+	// Boards draws an overview of the namespaces, each linked to a board of its own
+	Boards *bool `yaml:"boards"`
+	// Steps is the task whose execution order is animated
+	Steps string `yaml:"steps"`
+	// Sequence draws a sequence diagram of a task instead of the graph
+	Sequence struct {
+		Task  string `yaml:"task"`
+		Depth *int   `yaml:"depth"`
+	} `yaml:"sequence"`
+	// Elk holds the options of the ELK layout engine, such as nodeNodeBetweenLayers
+	Elk       map[string]string `yaml:"elk"`
+	Theme     *int              `yaml:"theme"`
+	DarkTheme *int              `yaml:"darkTheme"`
+	// IconSet is the built-in icon set: light, dark or monochrome
+	IconSet string `yaml:"iconSet"`
+	// Legend is the legend mode: auto, full, none or separate
+	Legend string `yaml:"legend"`
+	// Icons maps icon names such as externalTask to the URL, data URI or SVG file of the icon to use instead
+	Icons map[string]string `yaml:"icons"`
+	// Styles are applied in order, after the default styles
+	Styles []StyleRule `yaml:"styles"`
+}
+
+// ParseConfig parses a configuration file, rejecting unknown settings so that typos do not go unnoticed.
+func ParseConfig(configYaml []byte) (*Config, error) {
+	var config Config
+	decoder := yaml.NewDecoder(bytes.NewReader(configYaml))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	for iconName := range config.Icons {
+		if _, isKnown := configIconNames[iconName]; !isKnown {
+			return nil, fmt.Errorf("unknown icon %q, expected one of %s", iconName, strings.Join(slices.Sorted(maps.Keys(configIconNames)), ", "))
+		}
+	}
+	for i := range config.Styles {
+		if err := config.Styles[i].Validate(); err != nil {
+			return nil, fmt.Errorf("style rule %d: %w", i+1, err)
+		}
+	}
+	return &config, nil
+}
+
+// Apply sets the flags of cmd that were not set on the command line to the values of the configuration.
+func (c *Config) Apply(cmd *cobra.Command) error {
+	var settings [][2]string
+	addSetting := func(flagName, value string) {
+		settings = append(settings, [2]string{flagName, value})
+	}
+	if c.Format != "" {
+		addSetting("format", c.Format)
+	}
+	if c.Filters.Platform != "" {
+		addSetting("platform", c.Filters.Platform)
+	}
+	if len(c.Filters.Exclude) != 0 {
+		addSetting("exclude", strings.Join(c.Filters.Exclude, ","))
+	}
+	if c.ExpandLoops != nil {
+		addSetting("expand-loops", strconv.FormatBool(*c.ExpandLoops))
+	}
+	if c.VarsLayer != nil {
+		addSetting("vars-layer", strconv.FormatBool(*c.VarsLayer))
+	}
+	if c.Boards != nil {
+		addSetting("boards", strconv.FormatBool(*c.Boards))
+	}
+	if c.Steps != "" {
+		addSetting("steps", c.Steps)
+	}
+	if c.Sequence.Task != "" {
+		addSetting("sequence", c.Sequence.Task)
+	}
+	if c.VarsProvenance != nil {
+		addSetting("vars-provenance", strconv.FormatBool(*c.VarsProvenance))
+	}
+	if c.Layout != "" {
+		addSetting("layout", c.Layout)
+	}
+	if c.Direction != "" {
+		addSetting("direction", c.Direction)
+	}
+	addIntSetting := func(flagName string, value *int) {
+		if value != nil {
+			addSetting(flagName, strconv.Itoa(*value))
+		}
+	}
+	addIntSetting("pad", c.Pad)
+	addIntSetting("grid-rows", c.Grid.Rows)
+	addIntSetting("grid-columns", c.Grid.Columns)
+	addIntSetting("grid-gap", c.Grid.Gap)
+	addIntSetting("sequence-depth", c.Sequence.Depth)
+	if len(c.Elk) != 0 {
+		var options []string
+		for _, name := range slices.Sorted(maps.Keys(c.Elk)) {
+			options = append(options, fmt.Sprintf("%s=%s", name, c.Elk[name]))
+		}
+		addSetting("elk", strings.Join(options, ","))
+	}
+	if c.Theme != nil {
+		addSetting("theme", strconv.Itoa(*c.Theme))
+	}
+	if c.DarkTheme != nil {
+		addSetting("dark-theme", strconv.Itoa(*c.DarkTheme))
+	}
+	if c.IconSet != "" {
+		addSetting("icons", c.IconSet)
+	}
+	if c.Legend != "" {
+		addSetting("legend", c.Legend)
+	}
+	for _, setting := range settings {
+		flag := cmd.Flags().Lookup(setting[0])
+		if flag == nil || flag.Changed {
+			continue
+		}
+		if err := cmd.Flags().Set(setting[0], setting[1]); err != nil {
+			return fmt.Errorf("invalid %s: %w", setting[0], err)
+		}
+	}
+	return nil
+}
+
+// LoadIcons returns the icons of the configuration by the D2 variables they replace.
+// Icon files are relative to dir, the directory of the configuration file.
+func (c *Config) LoadIcons(dir string) (IconSet, error) {
+	icons := make(IconSet)
+	for iconName, icon := range c.Icons {
+		icon, err := LoadIcon(dir, icon)
+		if err != nil {
+			return nil, fmt.Errorf("icon %s: %w", iconName, err)
+		}
+		icons[configIconNames[iconName]] = icon
+	}
+	return icons, nil
+}
+
+// LoadOptions reads the configuration file given with --config, otherwise the one next to the Taskfile
+// at inputPath if there is one, and applies it to the flags of cmd. It returns the diagram options
+// of the flags, with the style rules and icons of the configuration.
+func LoadOptions(cmd *cobra.Command, inputPath string) (*Options, error) {
+	path := configPath
+	if path == "" {
+		dir := "."
+		if inputPath != "-" {
+			dir = filepath.Dir(inputPath)
+		}
+		path = filepath.Join(dir, configFileName)
+		if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			path = ""
+		}
+	}
+	var config Config
+	if path != "" {
+		configYaml, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		parsedConfig, err := ParseConfig(configYaml)
+		if err != nil {
+			return nil, fmt.Errorf("error reading the configuration %s: %w", path, err)
+		}
+		config = *parsedConfig
+		if err := config.Apply(cmd); err != nil {
+			return nil, fmt.Errorf("error applying the configuration %s: %w", path, err)
+		}
+	}
+	options := diagramOptions
+	options.Revision = revision
+	options.Styles = config.Styles
+	iconOverrides, err := config.LoadIcons(filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("error applying the configuration %s: %w", path, err)
+	}
+	options.IconOverrides = iconOverrides
+	return &options, nil
+}
@@ -2,11 +2,15 @@ package main
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
+
+	"github.com/google/uuid"
 )
 
 type D2Writer struct {
 	data []string
+	ids  int
 }
 
 func NewD2Writer() *D2Writer {
@@ -22,6 +26,23 @@ func (w *D2Writer) Write(key string, values ...string) {
 	}
 }
 
+// NewID returns a unique key for anonymous nodes. The keys are derived from a counter rather than
+// random, so that generating the same Taskfile twice gives the same output.
+func (w *D2Writer) NewID() string {
+	w.ids++
+	return uuid.NewSHA1(uuid.Nil, []byte(strconv.Itoa(w.ids))).String()
+}
+
 func (w *D2Writer) String() string {
 	return strings.Join(w.data, "\n")
 }
+
+// Block returns the written lines as an indented D2 map, to nest them under a key such as a board.
+func (w *D2Writer) Block() string {
+	return fmt.Sprintf("{\n  %s\n}", strings.ReplaceAll(w.String(), "\n", "\n  "))
+}
+
+// Quote returns s as a double quoted D2 string, so that it may contain newlines and reserved characters.
+func Quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Edge kinds of the Taskfile graph
+const (
+	DependencyEdge   = "calls as dependency"
+	CallEdge         = "calls"
+	DeferredCallEdge = "deferred call"
+	RequiredVarEdge  = "required by"
+)
+
+// Edge connects a calling task to the called task, or a required variable to the task requiring it.
+type Edge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Kind string `json:"kind"`
+}
+
+func (e Edge) String() string {
+	return fmt.Sprintf("%s -> %s (%s)", e.From, e.To, e.Kind)
+}
+
+// GetEdges returns the distinct edges of the Taskfile, with calls by alias or to wildcard tasks
+// connected to the called task.
+func (tf *Taskfile) GetEdges() (result []Edge) {
+	addEdge := func(edge Edge) {
+		if !slices.Contains(result, edge) {
+			result = append(result, edge)
+		}
+	}
+	addCalls := func(from string, calls []TaskCall, kind string) {
+		for _, call := range calls {
+			to := call.TaskName
+			if calledTaskName, _, isLocalTask := tf.ResolveTaskName(to); isLocalTask {
+				to = calledTaskName
+			}
+			addEdge(Edge{From: from, To: to, Kind: kind})
+		}
+	}
+	for _, taskName := range slices.Sorted(maps.Keys(tf.Tasks)) {
+		task := tf.Tasks[taskName]
+		for _, requiredVar := range task.GetRequiredVars() {
+			addEdge(Edge{From: requiredVar.Name, To: taskName, Kind: RequiredVarEdge})
+		}
+		deferredCalls, _ := task.GetDefers()
+		addCalls(taskName, task.GetDepCalls(), DependencyEdge)
+		addCalls(taskName, task.GetCalls(), CallEdge)
+		addCalls(taskName, deferredCalls, DeferredCallEdge)
+	}
+	return
+}
+
+// TaskfileDiff is the structural difference between two Taskfiles.
+type TaskfileDiff struct {
+	AddedTasks   []string `json:"addedTasks"`
+	RemovedTasks []string `json:"removedTasks"`
+	ChangedTasks []string `json:"changedTasks"`
+	AddedEdges   []Edge   `json:"addedEdges"`
+	RemovedEdges []Edge   `json:"removedEdges"`
+	// UnchangedEdges are only used to draw the diagram
+	UnchangedEdges []Edge `json:"-"`
+	// UnchangedTasks are only used to draw the diagram
+	UnchangedTasks []string `json:"-"`
+}
+
+func (d *TaskfileDiff) IsEmpty() bool {
+	return len(d.AddedTasks)+len(d.RemovedTasks)+len(d.ChangedTasks)+len(d.AddedEdges)+len(d.RemovedEdges) == 0
+}
+
+// DiffTaskfiles computes the added, removed and changed tasks, and the added and removed edges,
+// including required variables, between the old and the new Taskfile.
+func DiffTaskfiles(oldTaskfile, newTaskfile *Taskfile) *TaskfileDiff {
+	// The lists are empty rather than nil, so that the JSON summary has [] and not null
+	diff := &TaskfileDiff{
+		AddedTasks:   []string{},
+		RemovedTasks: []string{},
+		ChangedTasks: []string{},
+		AddedEdges:   []Edge{},
+		RemovedEdges: []Edge{},
+	}
+	for _, taskName := range slices.Sorted(maps.Keys(oldTaskfile.Tasks)) {
+		if _, isKept := newTaskfile.Tasks[taskName]; !isKept {
+			diff.RemovedTasks = append(diff.RemovedTasks, taskName)
+		}
+	}
+	for _, taskName := range slices.Sorted(maps.Keys(newTaskfile.Tasks)) {
+		oldTask, isKept := oldTaskfile.Tasks[taskName]
+		switch {
+		case !isKept:
+			diff.AddedTasks = append(diff.AddedTasks, taskName)
+		case !reflect.DeepEqual(oldTask, newTaskfile.Tasks[taskName]):
+			diff.ChangedTasks = append(diff.ChangedTasks, taskName)
+		default:
+			diff.UnchangedTasks = append(diff.UnchangedTasks, taskName)
+		}
+	}
+	oldEdges, newEdges := oldTaskfile.GetEdges(), newTaskfile.GetEdges()
+	for _, edge := range oldEdges {
+		if !slices.Contains(newEdges, edge) {
+			diff.RemovedEdges = append(diff.RemovedEdges, edge)
+		}
+	}
+	for _, edge := range newEdges {
+		if slices.Contains(oldEdges, edge) {
+			diff.UnchangedEdges = append(diff.UnchangedEdges, edge)
+		} else {
+			diff.AddedEdges = append(diff.AddedEdges, edge)
+		}
+	}
+	return diff
+}
+
+// WriteDiffSummary writes the differences as text for humans, or as JSON.
+func WriteDiffSummary(w io.Writer, diff *TaskfileDiff, asJSON bool) error {
+	if asJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(diff)
+	}
+	if diff.IsEmpty() {
+		_, err := fmt.Fprintln(w, "No structural changes")
+		return err
+	}
+	var summary strings.Builder
+	writeSection := func(title string, lines ...[]string) {
+		prefixes := []string{"+", "-", "~"}
+		var sectionLines []string
+		for i, section := range lines {
+			for _, line := range section {
+				sectionLines = append(sectionLines, fmt.Sprintf("  %s %s", prefixes[i], line))
+			}
+		}
+		if len(sectionLines) != 0 {
+			fmt.Fprintf(&summary, "%s:\n%s\n", title, strings.Join(sectionLines, "\n"))
+		}
+	}
+	edgeStrings := func(edges []Edge, kindFilter func(string) bool) (result []string) {
+		for _, edge := range edges {
+			if kindFilter(edge.Kind) {
+				result = append(result, edge.String())
+			}
+		}
+		return
+	}
+	isRequiredVar := func(kind string) bool { return kind == RequiredVarEdge }
+	isCall := func(kind string) bool { return kind != RequiredVarEdge }
+	writeSection("Tasks", diff.AddedTasks, diff.RemovedTasks, diff.ChangedTasks)
+	writeSection("Calls", edgeStrings(diff.AddedEdges, isCall), edgeStrings(diff.RemovedEdges, isCall))
+	writeSection("Required variables", edgeStrings(diff.AddedEdges, isRequiredVar), edgeStrings(diff.RemovedEdges, isRequiredVar))
+	_, err := io.WriteString(w, summary.String())
+	return err
+}
+
+// DiffToD2 draws the union of both Taskfiles' graphs, with added elements in green,
+// removed elements in red and changed tasks in amber.
+func DiffToD2(taskfiles []*Taskfile, diff *TaskfileDiff) string {
+	const (
+		addedColor   = "'#2e7d32'"
+		removedColor = "'#c62828'"
+		changedColor = "'#ff8f00'"
+	)
+	d2Writer := NewD2Writer()
+	d2Writer.Write("Legend", `{
+  near: top-center
+  Added: {style.fill: '#c8e6c9'; style.stroke: `+addedColor+`}
+  Removed: {style.fill: '#ffcdd2'; style.stroke: `+removedColor+`}
+  Changed: {style.fill: '#ffe0b2'; style.stroke: `+changedColor+`}
+}`)
+	d2Key := func(name string) string {
+		for _, taskfile := range taskfiles {
+			if _, isLocalTask := taskfile.Tasks[name]; isLocalTask {
+				return fmt.Sprintf("'%s'", name)
+			}
+		}
+		return fmt.Sprintf("'%s'", strings.ReplaceAll(name, ":", "'.'"))
+	}
+	writeTasks := func(taskNames []string, style string) {
+		for _, taskName := range taskNames {
+			d2Writer.Write(d2Key(taskName), style)
+		}
+	}
+	writeTasks(diff.UnchangedTasks, "{}")
+	writeTasks(diff.AddedTasks, "{style.fill: '#c8e6c9'; style.stroke: "+addedColor+"}")
+	writeTasks(diff.RemovedTasks, "{style.fill: '#ffcdd2'; style.stroke: "+removedColor+"; style.stroke-dash: 3}")
+	writeTasks(diff.ChangedTasks, "{style.fill: '#ffe0b2'; style.stroke: "+changedColor+"}")
+	writeEdges := func(edges []Edge, style string) {
+		for _, edge := range edges {
+			from := d2Key(edge.From)
+			if edge.Kind == RequiredVarEdge {
+				from = fmt.Sprintf("'%s'", edge.From)
+				d2Writer.Write(from, "{shape: oval}")
+			}
+			d2Writer.Write(fmt.Sprintf("%s -> %s", from, d2Key(edge.To)), fmt.Sprintf("%s %s", edge.Kind, style))
+		}
+	}
+	writeEdges(diff.UnchangedEdges, "{}")
+	writeEdges(diff.AddedEdges, "{style.stroke: "+addedColor+"; style.stroke-width: 3}")
+	writeEdges(diff.RemovedEdges, "{style.stroke: "+removedColor+"; style.stroke-dash: 3}")
+	return d2Writer.String()
+}
+
+var (
+	diffFormat     string
+	diffOutputPath string
+	diffFrom       string
+	diffTo         string
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff [old.yml] [new.yml]",
+	Short: "Show the structural differences between two Taskfiles as a D2 diagram, text or JSON",
+	Example: `# Diagram of the changes, added elements in green, removed in red and changed in amber
+taskfile2d2 diff old.yml Taskfile.yml -o changes.d2
+
+# Summary for a pull request comment
+taskfile2d2 diff old.yml Taskfile.yml --format text
+
+# Changes introduced by a branch, read with git without checking it out
+taskfile2d2 diff --from main --to HEAD Taskfile.yml
+
+# Changes of the working tree since the last commit, the Taskfile being discovered like the task CLI does
+taskfile2d2 diff --from HEAD`,
+	Args: cobra.MaximumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		var paths, revisions []string
+		switch {
+		case len(args) == 2 && diffFrom == "" && diffTo == "":
+			paths, revisions = args, []string{"", ""}
+		case len(args) == 2:
+			return fmt.Errorf("--from and --to compare a single Taskfile between git revisions, pass one path only")
+		case diffFrom == "":
+			return fmt.Errorf("pass the old and the new Taskfile, or a git revision with --from")
+		default:
+			inputPath, err := SelectTaskfile(args)
+			if errors.Is(err, errNoInput) {
+				return cmd.Help()
+			}
+			if err != nil {
+				return err
+			}
+			paths, revisions = []string{inputPath, inputPath}, []string{diffFrom, diffTo}
+		}
+		var taskfiles []*Taskfile
+		for i, path := range paths {
+			taskfileYaml, err := ReadTaskfileAtRevision(revisions[i], path)
+			if err != nil {
+				return err
+			}
+			taskfile, err := ParseTaskfile(taskfileYaml)
+			if err != nil {
+				return fmt.Errorf("error processing %s: %w", path, err)
+			}
+			taskfiles = append(taskfiles, taskfile)
+		}
+		diff := DiffTaskfiles(taskfiles[0], taskfiles[1])
+		switch diffFormat {
+		case "d2":
+			return WriteOutput(diffOutputPath, DiffToD2(taskfiles, diff))
+		case "text", "json":
+			var summary strings.Builder
+			if err := WriteDiffSummary(&summary, diff, diffFormat == "json"); err != nil {
+				return err
+			}
+			return WriteOutput(diffOutputPath, summary.String())
+		}
+		return fmt.Errorf("unknown format %q, expected d2, text or json", diffFormat)
+	},
+}
+
+func init() {
+	diffCmd.Flags().StringVar(&diffFormat, "format", "d2", "output format: d2, text or json")
+	diffCmd.Flags().StringVarP(&diffOutputPath, "output", "o", "-", "path of the output file, - for the standard output")
+	diffCmd.Flags().StringVar(&diffFrom, "from", "", "git revision of the old Taskfile")
+	diffCmd.Flags().StringVar(&diffTo, "to", "", "git revision of the new Taskfile, the working tree if not set")
+	rootCmd.AddCommand(diffCmd)
+}
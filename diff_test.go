@@ -0,0 +1,93 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteDiffSummary(t *testing.T) {
+	const oldYaml = `
+version: '3'
+tasks:
+  lint: {}
+  build:
+    deps: [lint]
+  docs: {}
+`
+	tests := []struct {
+		name    string
+		newYaml string
+		asJSON  bool
+		want    string
+	}{
+		{
+			name:    "no changes",
+			newYaml: oldYaml,
+			want:    "No structural changes\n",
+		},
+		{
+			name: "tasks and calls",
+			newYaml: `
+version: '3'
+tasks:
+  lint: {}
+  build:
+    cmds:
+      - task: test
+  test:
+    requires:
+      vars: [PACKAGE]
+`,
+			want: `Tasks:
+  + test
+  - docs
+  ~ build
+Calls:
+  + build -> test (calls)
+  - build -> lint (calls as dependency)
+Required variables:
+  + PACKAGE -> test (required by)
+`,
+		},
+		{
+			name: "JSON with empty lists",
+			newYaml: `
+version: '3'
+tasks:
+  lint: {}
+  build:
+    deps: [lint]
+`,
+			asJSON: true,
+			want: `{
+  "addedTasks": [],
+  "removedTasks": [
+    "docs"
+  ],
+  "changedTasks": [],
+  "addedEdges": [],
+  "removedEdges": []
+}
+`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			oldTaskfile, err := ParseTaskfile([]byte(oldYaml))
+			if err != nil {
+				t.Fatal(err)
+			}
+			newTaskfile, err := ParseTaskfile([]byte(test.newYaml))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var summary strings.Builder
+			if err := WriteDiffSummary(&summary, DiffTaskfiles(oldTaskfile, newTaskfile), test.asJSON); err != nil {
+				t.Fatal(err)
+			}
+			if summary.String() != test.want {
+				t.Errorf("WriteDiffSummary() =\n%s\nwant\n%s", summary.String(), test.want)
+			}
+		})
+	}
+}
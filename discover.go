@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// defaultTaskfileNames are the Taskfile names looked up by the task CLI, in order of priority.
+var defaultTaskfileNames = []string{
+	"Taskfile.yml",
+	"taskfile.yml",
+	"Taskfile.yaml",
+	"taskfile.yaml",
+	"Taskfile.dist.yml",
+	"taskfile.dist.yml",
+	"Taskfile.dist.yaml",
+	"taskfile.dist.yaml",
+}
+
+var errTaskfileNotFound = errors.New("no Taskfile found")
+
+// FindTaskfile returns the path of the Taskfile the task CLI would use.
+// dir is the directory to start from (the working directory if empty), taskfile is an optional
+// Taskfile or directory path relative to dir. Without taskfile, the parent directories of dir
+// are searched as well.
+func FindTaskfile(dir, taskfile string) (string, error) {
+	if dir == "" {
+		workingDir, err := os.Getwd()
+		if err != nil {
+			return "", err
+		}
+		dir = workingDir
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	if taskfile != "" {
+		if !filepath.IsAbs(taskfile) {
+			taskfile = filepath.Join(dir, taskfile)
+		}
+		info, err := os.Stat(taskfile)
+		if err != nil {
+			return "", err
+		}
+		if !info.IsDir() {
+			return taskfile, nil
+		}
+		if path, found := findTaskfileIn(taskfile); found {
+			return path, nil
+		}
+		return "", fmt.Errorf("%w in %s", errTaskfileNotFound, taskfile)
+	}
+	for searchDir := dir; ; {
+		if path, found := findTaskfileIn(searchDir); found {
+			return path, nil
+		}
+		parentDir := filepath.Dir(searchDir)
+		if parentDir == searchDir {
+			return "", fmt.Errorf("%w in %s or any of its parent directories", errTaskfileNotFound, dir)
+		}
+		searchDir = parentDir
+	}
+}
+
+func findTaskfileIn(dir string) (string, bool) {
+	for _, name := range defaultTaskfileNames {
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, true
+		}
+	}
+	return "", false
+}
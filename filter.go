@@ -0,0 +1,67 @@
+package main
+
+import (
+	"maps"
+	"path"
+	"slices"
+)
+
+// MatchTaskName reports whether the task name matches the glob pattern, e.g. `deploy:*`.
+// A malformed pattern matches nothing.
+func MatchTaskName(pattern, taskName string) bool {
+	matches, err := path.Match(pattern, taskName)
+	return err == nil && matches
+}
+
+// ExcludeTasks removes the tasks whose name matches one of the glob patterns, together with their calls.
+func (tf *Taskfile) ExcludeTasks(patterns []string) {
+	isExcluded := func(taskName string) bool {
+		return slices.ContainsFunc(patterns, func(pattern string) bool { return MatchTaskName(pattern, taskName) })
+	}
+	tf.filterCalls(func(_ *Task, entry map[string]any) bool {
+		calledTaskName, isCall := entry["task"].(string)
+		if !isCall {
+			return false
+		}
+		if resolvedTaskName, _, isLocalTask := tf.ResolveTaskName(calledTaskName); isLocalTask && isExcluded(resolvedTaskName) {
+			return true
+		}
+		return isExcluded(calledTaskName)
+	})
+	for _, taskName := range slices.Collect(maps.Keys(tf.Tasks)) {
+		if isExcluded(taskName) {
+			delete(tf.Tasks, taskName)
+		}
+	}
+}
+
+// filterCalls removes the deps and commands of every task for which isRemoved returns true,
+// deferred task calls included. String deps are given to isRemoved as a call map.
+func (tf *Taskfile) filterCalls(isRemoved func(caller *Task, entry map[string]any) bool) {
+	for taskName, task := range tf.Tasks {
+		task.Deps = slices.DeleteFunc(task.Deps, func(dep any) bool {
+			switch dep := dep.(type) {
+			case string:
+				return isRemoved(&task, map[string]any{"task": dep})
+			case map[string]any:
+				return isRemoved(&task, dep)
+			}
+			return false
+		})
+		filterCmd := func(cmd any) bool {
+			typedCmd, isMap := cmd.(map[string]any)
+			if !isMap {
+				return false
+			}
+			if deferred, isDeferredCall := typedCmd["defer"].(map[string]any); isDeferredCall && isRemoved(&task, deferred) {
+				return true
+			}
+			return isRemoved(&task, typedCmd)
+		}
+		task.Cmds = slices.DeleteFunc(task.Cmds, filterCmd)
+		if task.Cmd != nil && filterCmd(task.Cmd) {
+			task.Cmd = nil
+		}
+		tf.Tasks[taskName] = task
+	}
+}
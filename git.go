@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ReadFileAtRevision reads the file at path as of the git revision rev (e.g. HEAD~3 or main),
+// using the git executable. path is relative to the working directory, as with `git show`.
+func ReadFileAtRevision(rev, path string) ([]byte, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, fmt.Errorf("reading %s at revision %s needs git: %w", path, rev, err)
+	}
+	var stdout, stderr bytes.Buffer
+	show := exec.Command("git", "-C", filepath.Dir(path), "show", fmt.Sprintf("%s:./%s", rev, filepath.Base(path)))
+	show.Stdout = &stdout
+	show.Stderr = &stderr
+	if err := show.Run(); err != nil {
+		return nil, fmt.Errorf("error reading %s at revision %s: %s", path, rev, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// ReadTaskfileAtRevision reads the Taskfile at path as of the git revision rev,
+// or from the working tree if rev is empty.
+func ReadTaskfileAtRevision(rev, path string) ([]byte, error) {
+	if rev == "" {
+		return ReadTaskfile(path)
+	}
+	if path == "-" {
+		return nil, fmt.Errorf("a git revision can not be read from the standard input, pass the path of the Taskfile")
+	}
+	return ReadFileAtRevision(rev, path)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+var (
+	layoutEngines = []string{"dagre", "elk", "tala"}
+	directions    = []string{"up", "down", "left", "right"}
+)
+
+// CheckLayout returns an error if the layout options are not valid.
+func CheckLayout(options *Options) error {
+	if options.Layout != "" && !slices.Contains(layoutEngines, options.Layout) {
+		return fmt.Errorf("unknown layout engine %q, expected one of %s", options.Layout, strings.Join(layoutEngines, ", "))
+	}
+	if options.Direction != "" && !slices.Contains(directions, options.Direction) {
+		return fmt.Errorf("unknown direction %q, expected one of %s", options.Direction, strings.Join(directions, ", "))
+	}
+	if len(options.Elk) != 0 && options.Layout != "elk" {
+		return fmt.Errorf("ELK options need the elk layout engine, add --layout elk")
+	}
+	return nil
+}
+
+// elkArgs returns the d2 command line flags setting the ELK options, sorted by name.
+func elkArgs(elkOptions map[string]string) (result []string) {
+	for _, name := range slices.Sorted(maps.Keys(elkOptions)) {
+		result = append(result, fmt.Sprintf("--elk-%s=%s", name, elkOptions[name]))
+	}
+	return
+}
+
+// WriteD2Config writes the render configuration of the diagram, so that D2 renders it as intended
+// without command line flags. The ELK options can not be configured in the diagram, the D2 command
+// setting them is written as a comment instead.
+func WriteD2Config(d2Writer *D2Writer, options *Options) {
+	if len(options.Elk) != 0 {
+		d2Writer.Write(fmt.Sprintf("# Render with the ELK options: d2 %s input.d2 output.svg", strings.Join(elkArgs(options.Elk), " ")))
+	}
+	if options.Layout != "" {
+		d2Writer.Write("vars.d2-config.layout-engine", options.Layout)
+	}
+	if options.Theme != 0 {
+		d2Writer.Write("vars.d2-config.theme-id", fmt.Sprint(options.Theme))
+	}
+	if options.DarkTheme >= 0 {
+		d2Writer.Write("vars.d2-config.dark-theme-id", fmt.Sprint(options.DarkTheme))
+	}
+	if options.Pad >= 0 {
+		d2Writer.Write("vars.d2-config.pad", fmt.Sprint(options.Pad))
+	}
+	if options.Direction != "" {
+		d2Writer.Write("direction", options.Direction)
+	}
+	if options.GridRows > 0 {
+		d2Writer.Write("grid-rows", fmt.Sprint(options.GridRows))
+	}
+	if options.GridColumns > 0 {
+		d2Writer.Write("grid-columns", fmt.Sprint(options.GridColumns))
+	}
+	if options.GridGap >= 0 {
+		d2Writer.Write("grid-gap", fmt.Sprint(options.GridGap))
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Legend modes of the --legend flag
+const (
+	// LegendAuto draws the legend entries of the elements present in the diagram
+	LegendAuto = "auto"
+	// LegendFull draws every legend entry
+	LegendFull = "full"
+	// LegendNone draws no legend
+	LegendNone = "none"
+	// LegendSeparate draws the entries of the auto legend on a board of their own, linked from the diagram
+	LegendSeparate = "separate"
+)
+
+var legendModes = []string{LegendAuto, LegendFull, LegendNone, LegendSeparate}
+
+// Legend entries, in their order in the legend
+const (
+	varLegendEntry              = "var"
+	externalTaskLegendEntry     = "externalTask"
+	internalTaskLegendEntry     = "internalTask"
+	unknownTaskLegendEntry      = "unknownTask"
+	includedTaskfileLegendEntry = "includedTaskfile"
+	silentTaskLegendEntry       = "silentTask"
+	deferredCallLegendEntry     = "deferredCall"
+	promptingTaskLegendEntry    = "promptingTask"
+	interactiveTaskLegendEntry  = "interactiveTask"
+)
+
+// markLegendEntry records that the diagram has an element explained by the legend entry.
+func (d *Diagram) markLegendEntry(entry string) {
+	d.legendEntries[entry] = struct{}{}
+}
+
+func styleRuleLegendEntry(i int) string {
+	return fmt.Sprintf("styleRule%d", i+1)
+}
+
+// iconLegendEntry is an icon of the legend with its description.
+type iconLegendEntry struct {
+	entry       string
+	iconName    string
+	label       string
+	description string
+}
+
+var iconLegendEntries = []iconLegendEntry{
+	{varLegendEntry, varIconName, "Variable", `
+      Variables are passed to tasks`},
+	{externalTaskLegendEntry, externalTaskIconName, "External Task", `
+      Tasks that can be called\
+      directly by the Task CLI tool.`},
+	{internalTaskLegendEntry, internalTaskIconName, "Internal Task", `
+      Tasks that can NOT be called\
+      directly by the Task CLI tool.`},
+	{unknownTaskLegendEntry, unknownTaskIconName, "Unknown Task", `
+      It is not possible to identify the origin of these\
+      tasks as they are
+      - a dynamically named task using template variable(s)\
+        that can not be resolved statically **or**
+      - a task in another imported Taskfile`},
+	{includedTaskfileLegendEntry, includedTaskfileIconName, "Included Taskfile", `
+      Container for tasks that are included from other Taskfiles`},
+}
+
+// WriteLegend writes the legend in the mode of the options. The entries of the auto and separate modes
+// are those recorded while writing the diagram, so it must be written after the tasks.
+// The entries are styled by the style rules, and the configured rules get entries of their own.
+func (d *Diagram) WriteLegend(d2Writer *D2Writer) {
+	mode := d.options.Legend
+	if mode == LegendNone {
+		return
+	}
+	// Styling the entries records matching style rules, the entries present are those of the diagram
+	diagramEntries := maps.Clone(d.legendEntries)
+	isPresent := func(entry string) bool {
+		_, isPresent := diagramEntries[entry]
+		return mode == LegendFull || isPresent
+	}
+	// The style of the entries is the one of an example task, not matched by task name patterns
+	exampleTaskfile := &Taskfile{Tasks: map[string]Task{"": {Silent: true}}}
+	formatStyle := func(fields []string) string {
+		return strings.Join(fields, "\n    ")
+	}
+
+	var legend strings.Builder
+	legend.WriteString(`Legend {
+  **.style: {
+    font-size: 30
+    bold: true
+  }
+`)
+	if mode != LegendSeparate {
+		legend.WriteString("  near: top-center\n")
+	}
+	legend.WriteString("  style.3d: true\n")
+	var iconEntries strings.Builder
+	for i, iconEntry := range iconLegendEntries {
+		if isPresent(iconEntry.entry) {
+			fmt.Fprintf(&iconEntries, `    icon%[1]d: %[2]s {
+      shape: image
+      icon: ${%[3]s}
+    }
+    icon%[1]dDescription: |md%[4]s
+    |
+`, i+1, iconEntry.label, iconEntry.iconName, iconEntry.description)
+		}
+	}
+	if iconEntries.Len() != 0 {
+		fmt.Fprintf(&legend, `  subLegend1: "" {
+    style.opacity: 0
+    grid-columns: 4
+%s  }
+`, iconEntries.String())
+	}
+	if isPresent(silentTaskLegendEntry) {
+		fmt.Fprintf(&legend, `  subLegend2: Silent Task {
+    %s
+    description: |md
+      Tasks that do NOT print their template resolution (**silent: true**).
+      - This makes sure that **template resolution does not expose secret** variables
+      - There could be other, less important reasons why a template resolution is not printed to the screen
+    |
+  }
+`, formatStyle(d.GetStyle(exampleTaskfile, "", "")))
+	}
+	if isPresent(deferredCallLegendEntry) {
+		fmt.Fprintf(&legend, `  subLegend3: Deferred Call {
+    caller: Task
+    cleanup: Cleanup Task
+    caller -> cleanup: %s
+    description: |md
+      Tasks called with **defer**. They run after the calling task finished, **even if it failed**.
+    |
+  }
+`, formatCallLabel([]string{DeferredCallEdge}, d.GetStyle(exampleTaskfile, DeferredCallEdge, "")))
+	}
+	if isPresent(promptingTaskLegendEntry) {
+		legend.WriteString(`  subLegend4: Prompting Task {
+    shape: hexagon
+    description: |md
+      Tasks that ask for confirmation before running (**prompt**).
+      - They can NOT run unattended, e.g. in CI, unless the prompt is skipped with **--yes**
+    |
+  }
+`)
+	}
+	if isPresent(interactiveTaskLegendEntry) {
+		legend.WriteString(`  subLegend5: Interactive Task {
+    style.double-border: true
+    description: |md
+      Tasks that need a terminal (**interactive: true**).
+    |
+  }
+`)
+	}
+	for i, rule := range d.options.Styles {
+		if !isPresent(styleRuleLegendEntry(i)) {
+			continue
+		}
+		description := rule.Legend
+		if description == "" {
+			description = rule.Match.String()
+		}
+		if rule.Match.Edge == "" {
+			fmt.Fprintf(&legend, "  %s: %s {\n    %s\n  }\n", styleRuleLegendEntry(i), Quote(description), formatStyle(rule.Style.D2Fields()))
+		} else {
+			fmt.Fprintf(&legend, `  %s: "" {
+    style.opacity: 0
+    caller: Task
+    callee: Task
+    caller -> callee: %s
+  }
+`, styleRuleLegendEntry(i), formatCallLabel([]string{Quote(description)}, rule.Style.D2Fields()))
+		}
+	}
+	legend.WriteString("}")
+
+	if mode == LegendSeparate {
+		d2Writer.Write(d2Writer.NewID(), "Legend {near: top-center; link: layers.legend}")
+		d2Writer.Write("layers.legend", fmt.Sprintf("{\n%s\n}", legend.String()))
+		return
+	}
+	d2Writer.Write(d2Writer.NewID(), legend.String())
+}
+
+// CheckLegendMode returns an error if mode is not a legend mode.
+func CheckLegendMode(mode string) error {
+	if !slices.Contains(legendModes, mode) {
+		return fmt.Errorf("unknown legend mode %q, expected one of %s", mode, strings.Join(legendModes, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Loop is the resolved form of the `for` attribute of a command or dependency.
+type Loop struct {
+	// Source describes what is iterated over, e.g. "[a, b]", "var FILES" or "sources".
+	Source string
+	// As is the name of the iteration variable (ITEM by default).
+	As string
+	// Iterations holds the loop variables of every statically known iteration.
+	// It is nil when the values are only known at runtime.
+	Iterations [][]Variable
+}
+
+// Label returns the annotation written on the edge of a looping call.
+func (l *Loop) Label() string {
+	return fmt.Sprintf("for each %s in %s", l.As, l.Source)
+}
+
+// GetLoop resolves the raw `for` attribute of a call made by task.
+// Variables referenced by `for: {var: NAME}` are looked up in the task's vars first,
+// then in the global vars. It returns nil if forValue is nil.
+func (tf *Taskfile) GetLoop(task *Task, forValue any) *Loop {
+	loop := &Loop{As: "ITEM"}
+	switch forValue := forValue.(type) {
+	case nil:
+		return nil
+	case string:
+		// "sources" and "generates" iterate over files only known at runtime
+		loop.Source = forValue
+	case []any:
+		loop.Source = fmt.Sprintf("[%s]", joinValues(forValue))
+		for _, item := range forValue {
+			loop.Iterations = append(loop.Iterations, []Variable{{Name: loop.As, Value: item}})
+		}
+	case map[string]any:
+		if as, hasAs := forValue["as"].(string); hasAs {
+			loop.As = as
+		}
+		if matrix, isMatrix := forValue["matrix"].(map[string]any); isMatrix {
+			loop.Source = fmt.Sprintf("matrix %s", strings.Join(slices.Sorted(maps.Keys(matrix)), ", "))
+			loop.Iterations = matrixIterations(loop.As, matrix)
+		} else if varName, isVar := forValue["var"].(string); isVar {
+			loop.Source = fmt.Sprintf("var %s", varName)
+			value, isKnown := task.Vars[varName]
+			if !isKnown {
+				value, isKnown = tf.Vars[varName]
+			}
+			if isKnown {
+				split, _ := forValue["split"].(string)
+				for _, item := range splitVarValue(value, split) {
+					loop.Iterations = append(loop.Iterations, []Variable{{Name: loop.As, Value: item}})
+				}
+			}
+		} else {
+			loop.Source = "?"
+		}
+	default:
+		loop.Source = fmt.Sprintf("%v", forValue)
+	}
+	return loop
+}
+
+// matrixIterations returns the cartesian product of the matrix rows.
+// Loop variables are named after the matrix keys, e.g. ITEM.OS and ITEM.ARCH.
+func matrixIterations(as string, matrix map[string]any) [][]Variable {
+	iterations := [][]Variable{nil}
+	for _, key := range slices.Sorted(maps.Keys(matrix)) {
+		values, isList := matrix[key].([]any)
+		if !isList {
+			// A matrix row referencing a variable cannot be expanded statically
+			return nil
+		}
+		var product [][]Variable
+		for _, iteration := range iterations {
+			for _, value := range values {
+				product = append(product, append(slices.Clone(iteration), Variable{
+					Name:  fmt.Sprintf("%s.%s", as, key),
+					Value: value,
+				}))
+			}
+		}
+		iterations = product
+	}
+	return iterations
+}
+
+// splitVarValue returns the items a variable value is iterated over,
+// or nil if the value is computed at runtime (sh, ref or templated).
+func splitVarValue(value any, split string) []any {
+	switch value := value.(type) {
+	case []any:
+		return value
+	case string:
+		if strings.Contains(value, "{{") {
+			return nil
+		}
+		var items []any
+		if split == "" {
+			for _, item := range strings.Fields(value) {
+				items = append(items, item)
+			}
+		} else {
+			for _, item := range strings.Split(value, split) {
+				items = append(items, item)
+			}
+		}
+		return items
+	}
+	return nil
+}
+
+func joinValues(values []any) string {
+	var result []string
+	for _, value := range values {
+		result = append(result, fmt.Sprintf("%v", value))
+	}
+	return strings.Join(result, ", ")
+}
+
+// SubstituteVars replaces simple `{{.NAME}}` references to the given variables in s.
+func SubstituteVars(s string, vars []Variable) string {
+	for _, variable := range vars {
+		pattern := regexp.MustCompile(fmt.Sprintf(`\{\{-?\s*\.%s\s*-?\}\}`, regexp.QuoteMeta(variable.Name)))
+		s = pattern.ReplaceAllLiteralString(s, fmt.Sprintf("%v", variable.Value))
+	}
+	return s
+}
+
+// ExpandLoop returns one call per statically known iteration of the call's loop,
+// with the loop variables substituted in the called task name and passed variables.
+func (tc TaskCall) ExpandLoop(loop *Loop) (result []TaskCall) {
+	for _, iteration := range loop.Iterations {
+		expanded := TaskCall{
+			TaskName: SubstituteVars(tc.TaskName, iteration),
+		}
+		for _, passedVar := range tc.Vars {
+			if value, isString := passedVar.Value.(string); isString {
+				expanded.Vars = append(expanded.Vars, Variable{Name: passedVar.Name, Value: SubstituteVars(value, iteration)})
+			} else {
+				expanded.Vars = append(expanded.Vars, passedVar)
+			}
+		}
+		result = append(result, expanded)
+	}
+	return
+}
+
+func formatIteration(iteration []Variable) string {
+	var result []string
+	for _, variable := range iteration {
+		result = append(result, fmt.Sprintf("%s=%v", variable.Name, variable.Value))
+	}
+	return strings.Join(result, ", ")
+}
+
+// CallRun is a run of the task called by a call.
+type CallRun struct {
+	TaskName string
+	// Iteration holds the loop variables of the run, nil if the call does not loop
+	// or its iterations are only known at runtime.
+	Iteration []Variable
+}
+
+// GetCallRuns returns the runs of the task called by taskCall from caller: one per statically known
+// iteration of its loop, or else a single one. Templated names are resolved with the values of each
+// iteration, the runs whose name does not resolve to a single task being skipped since the called task
+// is only known at runtime.
+func (tf *Taskfile) GetCallRuns(caller *Task, taskCall TaskCall) (runs []CallRun) {
+	loop := tf.GetLoop(caller, taskCall.For)
+	iterations := [][]Variable{nil}
+	if loop != nil && len(loop.Iterations) != 0 {
+		iterations = loop.Iterations
+	}
+	for _, iteration := range iterations {
+		run := CallRun{TaskName: taskCall.TaskName, Iteration: iteration}
+		if strings.Contains(run.TaskName, "{{") {
+			iterationLoop := loop
+			if iteration != nil {
+				iterationLoop = &Loop{Source: loop.Source, As: loop.As, Iterations: [][]Variable{iteration}}
+			}
+			candidates := tf.ResolveTemplatedTaskName(caller, run.TaskName, iterationLoop)
+			if len(candidates) != 1 {
+				continue
+			}
+			run.TaskName = candidates[0]
+		}
+		runs = append(runs, run)
+	}
+	return
+}
@@ -1,16 +1,19 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
-	"io/fs"
 	"log"
 	"maps"
 	"os"
+	"os/signal"
+	"regexp"
 	"slices"
 	"strings"
+	"syscall"
 
-	"github.com/google/uuid"
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v3"
 )
@@ -23,21 +26,43 @@ const (
 	includedTaskfileIconName = "includedTaskfileIcon"
 )
 
-var includesToIncludedTasks = make(map[string]map[string]struct{})
-
 func main() {
-	rootCmd.Execute()
+	// Ctrl+C cancels the context of the commands, stopping --watch, serve and the rendering with D2
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
+	if err != nil {
+		os.Exit(1)
+	}
 }
 
 var rootCmd = &cobra.Command{
 	Use:   "taskfile2d2 [Taskfile.yml] [Taskfile.yml.d2]",
 	Short: "taskfile2d2 is a tool that generates a Terrastruct D2 diagram file from a Taskfile",
-	Example: `# Examples for passing input as argument:
+	Example: `# Without arguments, the Taskfile is searched in the current directory and its parent directories, like the task CLI does.
+# The output is written next to it, to "Taskfile.yml.d2"
+taskfile2d2
+
+# Searching the Taskfile from another directory, or passing its path like with the task CLI
+taskfile2d2 --dir ./project
+taskfile2d2 --taskfile ./project/Taskfile.dist.yml
+
+# Examples for passing input as argument:
 # Passing the input as argument without specifying the output, will write the output to "ARG1.d2" where ARG1 is the first argument (Taskfile.yml)
 taskfile2d2 Taskfile.yml
 
 # Passing the input as argument, while also specifying the output file
 taskfile2d2 Taskfile.yml out.d2
+taskfile2d2 Taskfile.yml -o out.d2
+
+# Writing the output to the standard output
+taskfile2d2 Taskfile.yml -o -
+
+# Reading the Taskfile as of a git revision, without checking it out
+taskfile2d2 Taskfile.yml --rev HEAD~3 -o old.d2
+
+# Failing when the committed diagram is not up to date, e.g. in a pre-commit hook or CI
+taskfile2d2 Taskfile.yml --check
 
 
 # Examples for passing input via standard input. The output to the standard output:
@@ -50,100 +75,163 @@ taskfile2d2 < Taskfile.yml > output.d2
 # Pipe the Taskfile from a remote source
 curl -s http://example.com/Taskfile.yml | taskfile2d2 > output.d2
 
+# "-" reads the standard input explicitly
+cat Taskfile.yml | taskfile2d2 - -o output.d2
+
 # Print the D2 content to terminal
-taskfile2d2 > output.d2
+taskfile2d2 < Taskfile.yml
 `,
 	Version: "0.0.1",
 	Args:    cobra.MaximumNArgs(2),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		// Check if stdin is connected to a terminal
-		fileInfo, err := os.Stdin.Stat()
+		cmd.SilenceUsage = true
+		selectInput := SelectInput
+		// Watching, reading a revision and checking the diagram next to the Taskfile need a file,
+		// the Taskfile is discovered rather than read from a standard input that may be an empty pipe
+		if watch || revision != "" || check {
+			selectInput = SelectTaskfile
+		}
+		inputPath, err := selectInput(args)
+		if errors.Is(err, errNoInput) {
+			return cmd.Help()
+		}
 		if err != nil {
-			return fmt.Errorf("error checking stdin: %w", err)
+			return err
 		}
-
-		if (fileInfo.Mode() & os.ModeNamedPipe) == 0 {
-			if len(args) == 0 {
-				return cmd.Help()
-			}
-			taskFile, err := os.ReadFile(args[0])
+		options, err := LoadOptions(cmd, inputPath)
+		if err != nil {
+			return err
+		}
+		if outputFormat != "d2" && outputFormat != "svg" {
+			return fmt.Errorf("unknown format %q, expected d2 or svg", outputFormat)
+		}
+		outputPath, err := SelectOutput(inputPath, args)
+		if err != nil {
+			return err
+		}
+		generate := func() error {
+			taskfileYaml, err := ReadTaskfileAtRevision(revision, inputPath)
 			if err != nil {
 				return err
 			}
-			d2, err := TaskfileToD2(taskFile)
+			d2, err := TaskfileToD2(taskfileYaml, inputPath, options)
 			if err != nil {
-				return err
+				return fmt.Errorf("error processing input: %w", err)
 			}
-			var d2OutFilePath string
-			if len(args) >= 2 {
-				d2OutFilePath = args[1]
-			} else {
-				d2OutFilePath = args[0] + ".d2"
-			}
-			os.WriteFile(d2OutFilePath, []byte(d2), fs.ModePerm)
-		} else {
-			err = ProcessIO(func(b []byte) ([]byte, error) {
-				d2, err := TaskfileToD2(b)
+			if outputFormat == "svg" {
+				svg, err := RenderSVG(cmd.Context(), d2, options)
 				if err != nil {
-					return nil, err
+					return err
 				}
-				return []byte(d2), nil
-			})
-			if err != nil {
-				return err
+				d2 = string(svg)
 			}
+			if check {
+				return CheckOutput(outputPath, d2)
+			}
+			return WriteOutput(outputPath, d2)
 		}
-		return nil
+		if watch {
+			if revision != "" {
+				return fmt.Errorf("--watch can not be used together with --rev")
+			}
+			if check {
+				return fmt.Errorf("--watch can not be used together with --check")
+			}
+			return WatchTaskfile(cmd.Context(), inputPath, func() {
+				if err := generate(); err != nil {
+					fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				} else if outputPath != "-" {
+					fmt.Fprintf(os.Stderr, "%s written\n", outputPath)
+				}
+			})
+		}
+		return generate()
 	},
 }
 
-// func initConfig() {
-// 	if cfgFile != "" {
-// 		// Use config file from the flag.
-// 		viper.SetConfigFile(cfgFile)
-// 	} else {
-// 		// Find home directory.
-// 		home, err := os.UserHomeDir()
-// 		cobra.CheckErr(err)
-
-// 		// Search config in home directory with name ".cobra" (without extension).
-// 		viper.AddConfigPath(home)
-// 		viper.SetConfigType("yaml")
-// 		viper.SetConfigName(".cobra")
-// 	}
+var (
+	taskfileDir  string
+	taskfileFlag string
+	outputPath   string
+	watch        bool
+	revision     string
+	check        bool
+	configPath   string
+	outputFormat string
+)
 
-// 	viper.AutomaticEnv()
+func init() {
+	rootCmd.PersistentFlags().StringVarP(&taskfileDir, "dir", "d", "", "directory to search the Taskfile in, including its parent directories")
+	rootCmd.PersistentFlags().StringVarP(&taskfileFlag, "taskfile", "t", "", "path of the Taskfile, or of the directory containing it")
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", "", "path of the configuration file, "+configFileName+" next to the Taskfile by default")
+	rootCmd.Flags().StringVarP(&outputPath, "output", "o", "", "path of the output file, - for the standard output")
+	rootCmd.Flags().StringVar(&revision, "rev", "", "read the Taskfile as of a git revision, e.g. HEAD~3")
+	rootCmd.Flags().BoolVarP(&watch, "watch", "w", false, "regenerate the output whenever the Taskfile or one of its included Taskfiles changes")
+	rootCmd.Flags().StringVar(&outputFormat, "format", "d2", "output format: d2, or svg rendered with the d2 executable")
+	rootCmd.Flags().StringVar(&d2Path, "d2", "d2", "path of the d2 executable used to render svg output")
+	rootCmd.Flags().BoolVar(&check, "check", false, "do not write the output file, print its differences with the generated diagram and fail if it is not up to date")
+	addDiagramFlags(rootCmd)
+}
 
-// 	if err := viper.ReadInConfig(); err == nil {
-// 		fmt.Println("Using config file:", viper.ConfigFileUsed())
-// 	}
-// }
+// addDiagramFlags adds the flags controlling the generated diagram to a command generating one.
+func addDiagramFlags(cmd *cobra.Command) {
+	defaults := NewOptions()
+	cmd.Flags().BoolVar(&diagramOptions.ExpandLoops, "expand-loops", defaults.ExpandLoops, "draw one call per statically known iteration of for loops")
+	cmd.Flags().BoolVar(&diagramOptions.VarsLayer, "vars-layer", defaults.VarsLayer, "draw global and task level vars, env and dotenv files")
+	cmd.Flags().StringVar(&diagramOptions.Platform, "platform", defaults.Platform, "hide the tasks and commands that would not run on the given platform, e.g. linux/amd64")
+	cmd.Flags().BoolVar(&diagramOptions.VarsProvenance, "vars-provenance", defaults.VarsProvenance, "annotate tasks with their shadowed variables and the sources they may come from")
+	cmd.Flags().StringSliceVar(&diagramOptions.Exclude, "exclude", defaults.Exclude, "hide the tasks matching the glob patterns, e.g. 'docs:*', and their calls")
+	cmd.Flags().StringVar(&diagramOptions.Layout, "layout", defaults.Layout, "D2 layout engine written in the diagram: dagre, elk or tala")
+	cmd.Flags().StringVar(&diagramOptions.Direction, "direction", defaults.Direction, "direction of the diagram: up, down, left or right")
+	cmd.Flags().IntVar(&diagramOptions.Pad, "pad", defaults.Pad, "padding around the rendered diagram, in pixels")
+	cmd.Flags().IntVar(&diagramOptions.GridRows, "grid-rows", defaults.GridRows, "lay the tasks out in a grid with the given number of rows")
+	cmd.Flags().IntVar(&diagramOptions.GridColumns, "grid-columns", defaults.GridColumns, "lay the tasks out in a grid with the given number of columns")
+	cmd.Flags().IntVar(&diagramOptions.GridGap, "grid-gap", defaults.GridGap, "gap between the cells of the grid, in pixels")
+	cmd.Flags().BoolVar(&diagramOptions.Boards, "boards", defaults.Boards, "draw an overview of the namespaces, linked to a board of their own for each namespace")
+	cmd.Flags().StringVar(&diagramOptions.Steps, "steps", defaults.Steps, "animate the order in which Task runs the given task and the tasks it calls, as D2 steps")
+	cmd.Flags().StringVar(&diagramOptions.Sequence, "sequence", defaults.Sequence, "draw a sequence diagram of the given task, its dependencies and the tasks it calls, instead of the graph")
+	cmd.Flags().IntVar(&diagramOptions.SequenceDepth, "sequence-depth", defaults.SequenceDepth, "levels of calls followed by the sequence diagram")
+	cmd.Flags().StringToStringVar(&diagramOptions.Elk, "elk", defaults.Elk, "ELK layout options, e.g. nodeNodeBetweenLayers=70,algorithm=layered")
+	cmd.Flags().IntVar(&diagramOptions.Theme, "theme", defaults.Theme, "D2 theme id written in the diagram")
+	cmd.Flags().IntVar(&diagramOptions.DarkTheme, "dark-theme", defaults.DarkTheme, "D2 theme id written in the diagram for viewers in dark mode, e.g. 200")
+	cmd.Flags().StringVar(&diagramOptions.IconSet, "icons", defaults.IconSet, "icon set: light, dark or monochrome")
+	cmd.Flags().StringVar(&diagramOptions.Legend, "legend", defaults.Legend, "legend mode: auto for the entries present in the diagram, full, none, or separate for auto entries on a board of their own")
+}
 
 type Task struct {
-	Desc     string
-	Summary  string
-	Silent   bool
-	Internal bool
-	Requires struct {
+	Desc        string
+	Summary     string
+	Label       string
+	Prompt      any
+	Silent      bool
+	Interactive bool
+	Internal    bool
+	Requires    struct {
 		Vars []any
 	}
-	Vars map[string]any
-	Deps []any
-	Cmd  any
-	Cmds []any
+	Aliases   []string
+	Platforms []string
+	Vars      map[string]any
+	Env       map[string]any
+	Dotenv    []string
+	Deps      []any
+	Cmd       any
+	Cmds      []any
 }
 type Taskfile struct {
 	Includes map[string]any
 	Version  string
 	Vars     map[string]any
+	Env      map[string]any
+	Dotenv   []string
 	Tasks    map[string]Task
+
+	// wildcardRegexps caches the compiled patterns of the wildcard tasks
+	wildcardRegexps map[string]*regexp.Regexp
 }
 
-func (tf *Taskfile) GetIncludes() (result []string) {
-	for key := range tf.Includes {
-		result = append(result, key)
-	}
-	return
+func (tf *Taskfile) GetIncludes() []string {
+	return slices.Sorted(maps.Keys(tf.Includes))
 }
 
 func (t *Task) GetDepCalls() (result []TaskCall) {
@@ -153,18 +241,15 @@ func (t *Task) GetDepCalls() (result []TaskCall) {
 		case string:
 			taskCall.TaskName = dep
 		case map[string]any:
-			taskCall.TaskName = dep["task"].(string)
-			passedVars, isVarMap := dep["vars"].(map[string]any)
-			if isVarMap {
-				for _, passedVarName := range slices.Sorted(maps.Keys(passedVars)) {
-					taskCall.Vars = append(taskCall.Vars, Variable{
-						Name:  passedVarName,
-						Value: passedVars[passedVarName],
-					})
-				}
+			taskName, hasTaskCall := dep["task"].(string)
+			if !hasTaskCall {
+				continue
 			}
+			taskCall.TaskName = taskName
+			taskCall.For = dep["for"]
+			taskCall.Vars = GetPassedVars(dep)
 		default:
-			panic("")
+			continue
 		}
 		result = append(result, taskCall)
 	}
@@ -189,6 +274,10 @@ type Variable struct {
 type TaskCall struct {
 	TaskName string
 	Vars     []Variable
+	// For is the raw `for` attribute of the call, nil if the call does not loop.
+	For any
+	// Platforms restricts the call to the given platforms.
+	Platforms []string
 }
 
 func (t *Task) GetCalls() (result []TaskCall) {
@@ -197,17 +286,11 @@ func (t *Task) GetCalls() (result []TaskCall) {
 			taskName, hasTaskCall := typedCmd["task"].(string)
 			if hasTaskCall {
 				taskCall := TaskCall{
-					TaskName: taskName,
-				}
-				passedVars, isVarMap := typedCmd["vars"].(map[string]any)
-				if isVarMap {
-					for _, passedVarName := range slices.Sorted(maps.Keys(passedVars)) {
-						taskCall.Vars = append(taskCall.Vars, Variable{
-							Name:  passedVarName,
-							Value: passedVars[passedVarName],
-						})
-					}
+					TaskName:  taskName,
+					For:       typedCmd["for"],
+					Platforms: GetPlatforms(typedCmd),
 				}
+				taskCall.Vars = GetPassedVars(typedCmd)
 				result = append(result, taskCall)
 			}
 		}
@@ -215,6 +298,72 @@ func (t *Task) GetCalls() (result []TaskCall) {
 	return
 }
 
+// GetDefers returns the task calls deferred with `defer: {task: ...}`
+// and the shell commands deferred with `defer: ...`.
+func (t *Task) GetDefers() (calls []TaskCall, cmds []string) {
+	for _, cmd := range t.GetCmds() {
+		typedCmd, isMap := cmd.(map[string]any)
+		if !isMap {
+			continue
+		}
+		switch deferred := typedCmd["defer"].(type) {
+		case string:
+			cmds = append(cmds, deferred)
+		case map[string]any:
+			if taskName, hasTaskCall := deferred["task"].(string); hasTaskCall {
+				calls = append(calls, TaskCall{
+					TaskName: taskName,
+					Vars:     GetPassedVars(deferred),
+				})
+			}
+		}
+	}
+	return
+}
+
+// GetPrompts returns the confirmation prompts of the task, given either as a string or a list.
+func (t *Task) GetPrompts() (result []string) {
+	switch prompt := t.Prompt.(type) {
+	case string:
+		result = append(result, prompt)
+	case []any:
+		for _, prompt := range prompt {
+			result = append(result, fmt.Sprintf("%v", prompt))
+		}
+	}
+	return
+}
+
+// GetAllCalls returns the dependency, command and deferred task calls of the task.
+func (t *Task) GetAllCalls() []TaskCall {
+	deferredCalls, _ := t.GetDefers()
+	return slices.Concat(t.GetDepCalls(), t.GetCalls(), deferredCalls)
+}
+
+// GetIncludeVars returns the vars passed to the Taskfile included under namespace.
+func (tf *Taskfile) GetIncludeVars(namespace string) map[string]any {
+	include, isMap := tf.Includes[namespace].(map[string]any)
+	if !isMap {
+		return nil
+	}
+	vars, _ := include["vars"].(map[string]any)
+	return vars
+}
+
+// GetPassedVars returns the variables passed by a task call, sorted by name.
+func GetPassedVars(call map[string]any) (result []Variable) {
+	passedVars, isVarMap := call["vars"].(map[string]any)
+	if isVarMap {
+		for _, passedVarName := range slices.Sorted(maps.Keys(passedVars)) {
+			result = append(result, Variable{
+				Name:  passedVarName,
+				Value: passedVars[passedVarName],
+			})
+		}
+	}
+	return
+}
+
 type RequiredVariable struct {
 	Name string
 	Enum []string
@@ -226,123 +375,176 @@ func (t *Task) GetRequiredVars() (result []RequiredVariable) {
 		case string:
 			result = append(result, RequiredVariable{Name: variable})
 		case map[string]any:
-			requiredVariable := RequiredVariable{
-				Name: variable["name"].(string),
-			}
-			for _, enum := range variable["enum"].([]any) {
-				requiredVariable.Enum = append(requiredVariable.Enum, enum.(string))
+			name, _ := variable["name"].(string)
+			requiredVariable := RequiredVariable{Name: name}
+			enum, _ := variable["enum"].([]any)
+			for _, value := range enum {
+				requiredVariable.Enum = append(requiredVariable.Enum, fmt.Sprintf("%v", value))
 			}
 			result = append(result, requiredVariable)
-		default:
-			panic("")
 		}
 	}
 	return
 }
-func TaskfileToD2(taskfileYaml []byte) (string, error) {
+
+// ParseTaskfile parses a version 3 Taskfile.
+func ParseTaskfile(taskfileYaml []byte) (*Taskfile, error) {
 	var taskfile Taskfile
 	err := yaml.Unmarshal(taskfileYaml, &taskfile)
 	if err != nil {
+		return nil, err
+	}
+	if err := CheckVersion(taskfile.Version); err != nil {
+		return nil, err
+	}
+	for _, taskName := range slices.Sorted(maps.Keys(taskfile.Tasks)) {
+		task := taskfile.Tasks[taskName]
+		if task.Cmd != nil && task.Cmds != nil {
+			return nil, fmt.Errorf("task %s cannot have both cmd and cmds", taskName)
+		}
+		if err := task.checkDeps(); err != nil {
+			return nil, fmt.Errorf("task %s: %w", taskName, err)
+		}
+		if err := task.checkRequiredVars(); err != nil {
+			return nil, fmt.Errorf("task %s: %w", taskName, err)
+		}
+	}
+	return &taskfile, nil
+}
+
+// checkDeps returns an error if a dependency is neither a task name nor a task call.
+func (t *Task) checkDeps() error {
+	for _, dep := range t.Deps {
+		switch dep.(type) {
+		case string, map[string]any:
+		default:
+			return fmt.Errorf("unsupported dependency: %v", dep)
+		}
+	}
+	return nil
+}
+
+// checkRequiredVars returns an error if a required variable is neither a name
+// nor a map with a name and an optional enum list.
+func (t *Task) checkRequiredVars() error {
+	for _, variable := range t.Requires.Vars {
+		switch variable := variable.(type) {
+		case string:
+		case map[string]any:
+			if _, hasName := variable["name"].(string); !hasName {
+				return fmt.Errorf("required variable without a name: %v", variable)
+			}
+			if enum, hasEnum := variable["enum"]; hasEnum {
+				if _, isList := enum.([]any); !isList {
+					return fmt.Errorf("the enum of required variable %v is not a list", variable["name"])
+				}
+			}
+		default:
+			return fmt.Errorf("unsupported required variable: %v", variable)
+		}
+	}
+	return nil
+}
+
+// Diagram holds the state of the generation of a diagram: its options and what was written so far.
+type Diagram struct {
+	options *Options
+	// legendEntries records the legend entries of the elements written, and the indexes
+	// of the configured style rules that matched, for the auto legend
+	legendEntries map[string]struct{}
+	// includedTasks records the tasks of each included Taskfile written on the current board
+	includedTasks map[string]map[string]struct{}
+	// namespaceTaskfiles holds the included Taskfiles read for the root Taskfile's board in multi-board mode,
+	// nil on the other boards and in single-board mode
+	namespaceTaskfiles map[string]*Taskfile
+}
+
+func NewDiagram(options *Options) *Diagram {
+	return &Diagram{options: options, legendEntries: make(map[string]struct{})}
+}
+
+// TaskfileToD2 returns the diagram of the Taskfile read from path, "-" meaning the standard input.
+// The path locates the included Taskfiles drawn on boards of their own in multi-board mode.
+func TaskfileToD2(taskfileYaml []byte, path string, options *Options) (string, error) {
+	taskfile, err := ParseTaskfile(taskfileYaml)
+	if err != nil {
+		return "", err
+	}
+	unvisualizedFeatures, err := GetUnvisualizedFeatures(taskfileYaml)
+	if err != nil {
+		return "", err
+	}
+	if len(unvisualizedFeatures) != 0 {
+		fmt.Fprintf(os.Stderr, "warning: the following Taskfile features are not visualized: %s\n", strings.Join(unvisualizedFeatures, "; "))
+	}
+	if options.Platform != "" {
+		taskfile.FilterPlatform(ParsePlatform(options.Platform))
+	}
+	if len(options.Exclude) != 0 {
+		taskfile.ExcludeTasks(options.Exclude)
+	}
+	if err := CheckLegendMode(options.Legend); err != nil {
 		return "", err
 	}
-	if taskfile.Version != "3" {
-		log.Fatal("Only version 3 Taskfiles are supported")
+	if err := CheckLayout(options); err != nil {
+		return "", err
+	}
+	if options.Steps != "" && options.Boards {
+		return "", fmt.Errorf("--steps animates a single board, it can not be combined with --boards")
 	}
+	if options.Sequence != "" && (options.Boards || options.Steps != "") {
+		return "", fmt.Errorf("--sequence replaces the graph, it can not be combined with --boards or --steps")
+	}
+	diagram := NewDiagram(options)
 	d2Writer := NewD2Writer()
-	d2Vars := fmt.Sprintf(`{
-  %s: %s
-  %s: %s
-  %s: %s
-  %s: %s
-  %s: %s
-}`,
-		externalTaskIconName,
-		`data:image/svg+xml,%3C%3Fxml version='1.0' encoding='utf-8'%3F%3E%3Csvg fill='%23000000' width='800px' height='800px' viewBox='0 0 24 24' xmlns='http://www.w3.org/2000/svg'%3E%3Cpath d='M5 22h14c1.103 0 2-.897 2-2V5c0-1.103-.897-2-2-2h-2a1 1 0 0 0-1-1H8a1 1 0 0 0-1 1H5c-1.103 0-2 .897-2 2v15c0 1.103.897 2 2 2zM5 5h2v2h10V5h2v15H5V5z'/%3E%3Cpath d='m11 13.586-1.793-1.793-1.414 1.414L11 16.414l5.207-5.207-1.414-1.414z'/%3E%3C/svg%3E`,
-		internalTaskIconName,
-		`data:image/svg+xml,%3C%3Fxml version='1.0' encoding='utf-8'%3F%3E%3Csvg fill='%23000000' width='800px' height='800px' viewBox='0 0 24 24' xmlns='http://www.w3.org/2000/svg'%3E%3Cpath d='M3 20c0 1.103.897 2 2 2h14c1.103 0 2-.897 2-2V5c0-1.103-.897-2-2-2h-2a1 1 0 0 0-1-1H8a1 1 0 0 0-1 1H5c-1.103 0-2 .897-2 2v15zM5 5h2v2h10V5h2v15H5V5z'/%3E%3Cpath d='M14.292 10.295 12 12.587l-2.292-2.292-1.414 1.414 2.292 2.292-2.292 2.292 1.414 1.414L12 15.415l2.292 2.292 1.414-1.414-2.292-2.292 2.292-2.292z'/%3E%3C/svg%3E`,
-		unknownTaskIconName,
-		`data:image/svg+xml,%3C%3Fxml version='1.0' encoding='utf-8'%3F%3E%3Csvg width='800px' height='800px' viewBox='0 0 24 24' fill='none' xmlns='http://www.w3.org/2000/svg'%3E%3Cpath fill-rule='evenodd' clip-rule='evenodd' d='M9.29289 1.29289C9.48043 1.10536 9.73478 1 10 1H18C19.6569 1 21 2.34315 21 4V7C21 7.55228 20.5523 8 20 8C19.4477 8 19 7.55228 19 7V4C19 3.44772 18.5523 3 18 3H11V8C11 8.55228 10.5523 9 10 9H5V20C5 20.5523 5.44772 21 6 21H11C11.5523 21 12 21.4477 12 22C12 22.5523 11.5523 23 11 23H6C4.34315 23 3 21.6569 3 20V8C3 7.73478 3.10536 7.48043 3.29289 7.29289L9.29289 1.29289ZM6.41421 7H9V4.41421L6.41421 7ZM18.25 20.75C18.25 21.4404 17.6904 22 17 22C16.3096 22 15.75 21.4404 15.75 20.75C15.75 20.0596 16.3096 19.5 17 19.5C17.6904 19.5 18.25 20.0596 18.25 20.75ZM15.1353 12.9643C15.3999 12.4596 16.0831 12 17 12C18.283 12 19 12.8345 19 13.5C19 14.1655 18.283 15 17 15C16.4477 15 16 15.4477 16 16V17C16 17.5523 16.4477 18 17 18C17.5523 18 18 17.5523 18 17V16.8866C19.6316 16.5135 21 15.2471 21 13.5C21 11.404 19.0307 10 17 10C15.4566 10 14.0252 10.7745 13.364 12.0357C13.1075 12.5248 13.2962 13.1292 13.7853 13.3857C14.2744 13.6421 14.8788 13.4535 15.1353 12.9643Z' fill='%23000000'/%3E%3C/svg%3E`,
-		varIconName,
-		`data:image/svg+xml,%3C%3Fxml%20version%3D%221.0%22%20encoding%3D%22iso-8859-1%22%3F%3E%0A%0A%3Csvg%20version%3D%221.1%22%20id%3D%22Capa_1%22%20xmlns%3D%22http%3A%2F%2Fwww.w3.org%2F2000%2Fsvg%22%20xmlns%3Axlink%3D%22http%3A%2F%2Fwww.w3.org%2F1999%2Fxlink%22%20x%3D%220px%22%20y%3D%220px%22%0A%09%20viewBox%3D%220%200%20512%20512%22%20style%3D%22enable-background%3Anew%200%200%20512%20512%3B%22%20xml%3Aspace%3D%22preserve%22%3E%0A%3Cpath%20style%3D%22fill%3A%23ECECF1%3B%22%20d%3D%22M421%2C0H91C49.6%2C0%2C16%2C33.6%2C16%2C75v362c0%2C41.4%2C33.6%2C75%2C75%2C75h330c41.4%2C0%2C75-33.6%2C75-75V75%0A%09C496%2C33.6%2C462.4%2C0%2C421%2C0z%22%2F%3E%0A%3Cpath%20style%3D%22fill%3A%23E2E2E7%3B%22%20d%3D%22M496%2C75v362c0%2C41.4-33.6%2C75-75%2C75H256V0h165C462.4%2C0%2C496%2C33.6%2C496%2C75z%22%2F%3E%0A%3Cpath%20style%3D%22fill%3A%235A5A5A%3B%22%20d%3D%22M136%2C75v362c0%2C8.401-6.599%2C15-15%2C15s-15-6.599-15-15V75c0-8.401%2C6.599-15%2C15-15S136%2C66.599%2C136%2C75z%22%0A%09%2F%3E%0A%3Cpath%20style%3D%22fill%3A%23444444%3B%22%20d%3D%22M136%2C75v362c0%2C8.401-6.599%2C15-15%2C15V60C129.401%2C60%2C136%2C66.599%2C136%2C75z%22%2F%3E%0A%3Cpath%20style%3D%22fill%3A%235A5A5A%3B%22%20d%3D%22M226%2C75v362c0%2C8.401-6.599%2C15-15%2C15s-15-6.599-15-15V75c0-8.401%2C6.599-15%2C15-15S226%2C66.599%2C226%2C75z%22%0A%09%2F%3E%0A%3Cpath%20style%3D%22fill%3A%23444444%3B%22%20d%3D%22M226%2C75v362c0%2C8.401-6.599%2C15-15%2C15V60C219.401%2C60%2C226%2C66.599%2C226%2C75z%22%2F%3E%0A%3Cpath%20style%3D%22fill%3A%235A5A5A%3B%22%20d%3D%22M316%2C75v362c0%2C8.401-6.599%2C15-15%2C15s-15-6.599-15-15V75c0-8.401%2C6.599-15%2C15-15S316%2C66.599%2C316%2C75z%22%0A%09%2F%3E%0A%3Cpath%20style%3D%22fill%3A%23444444%3B%22%20d%3D%22M316%2C75v362c0%2C8.401-6.599%2C15-15%2C15V60C309.401%2C60%2C316%2C66.599%2C316%2C75z%22%2F%3E%0A%3Cpath%20style%3D%22fill%3A%235A5A5A%3B%22%20d%3D%22M406%2C75v362c0%2C8.401-6.599%2C15-15%2C15s-15-6.599-15-15V75c0-8.401%2C6.599-15%2C15-15S406%2C66.599%2C406%2C75z%22%0A%09%2F%3E%0A%3Cpath%20style%3D%22fill%3A%23444444%3B%22%20d%3D%22M406%2C75v362c0%2C8.401-6.599%2C15-15%2C15V60C399.401%2C60%2C406%2C66.599%2C406%2C75z%22%2F%3E%0A%3Cpath%20style%3D%22fill%3A%23FF7816%3B%22%20d%3D%22M121%2C241c-24.901%2C0-45%2C21.099-45%2C46s20.099%2C45%2C45%2C45s45-20.099%2C45-45S145.901%2C241%2C121%2C241z%22%2F%3E%0A%3Cpath%20style%3D%22fill%3A%23FF4B00%3B%22%20d%3D%22M166%2C287c0%2C24.901-20.099%2C45-45%2C45v-91C145.901%2C241%2C166%2C262.099%2C166%2C287z%22%2F%3E%0A%3Cpath%20style%3D%22fill%3A%23FF7816%3B%22%20d%3D%22M391%2C90c-24.901%2C0-45%2C20.099-45%2C45s20.099%2C45%2C45%2C45s45-20.099%2C45-45S415.901%2C90%2C391%2C90z%22%2F%3E%0A%3Cpath%20style%3D%22fill%3A%23FF4B00%3B%22%20d%3D%22M436%2C135c0%2C24.901-20.099%2C45-45%2C45V90C415.901%2C90%2C436%2C110.099%2C436%2C135z%22%2F%3E%0A%3Cpath%20style%3D%22fill%3A%23FF7816%3B%22%20d%3D%22M301%2C332c-24.901%2C0-45%2C20.099-45%2C45s20.099%2C45%2C45%2C45s45-20.099%2C45-45S325.901%2C332%2C301%2C332z%22%2F%3E%0A%3Cpath%20style%3D%22fill%3A%23FF4B00%3B%22%20d%3D%22M346%2C377c0%2C24.901-20.099%2C45-45%2C45v-90C325.901%2C332%2C346%2C352.099%2C346%2C377z%22%2F%3E%0A%3Cpath%20style%3D%22fill%3A%23FF7816%3B%22%20d%3D%22M211%2C120c-24.901%2C0-45%2C20.099-45%2C45s20.099%2C45%2C45%2C45s45-20.099%2C45-45S235.901%2C120%2C211%2C120z%22%2F%3E%0A%3Cpath%20style%3D%22fill%3A%23FF4B00%3B%22%20d%3D%22M256%2C165c0%2C24.901-20.099%2C45-45%2C45v-90C235.901%2C120%2C256%2C140.099%2C256%2C165z%22%2F%3E%0A%3Cg%3E%0A%3C%2Fg%3E%0A%3Cg%3E%0A%3C%2Fg%3E%0A%3Cg%3E%0A%3C%2Fg%3E%0A%3Cg%3E%0A%3C%2Fg%3E%0A%3Cg%3E%0A%3C%2Fg%3E%0A%3Cg%3E%0A%3C%2Fg%3E%0A%3Cg%3E%0A%3C%2Fg%3E%0A%3Cg%3E%0A%3C%2Fg%3E%0A%3Cg%3E%0A%3C%2Fg%3E%0A%3Cg%3E%0A%3C%2Fg%3E%0A%3Cg%3E%0A%3C%2Fg%3E%0A%3Cg%3E%0A%3C%2Fg%3E%0A%3Cg%3E%0A%3C%2Fg%3E%0A%3Cg%3E%0A%3C%2Fg%3E%0A%3Cg%3E%0A%3C%2Fg%3E%0A%3C%2Fsvg%3E%0A`,
-		includedTaskfileIconName,
-		`data:image/svg+xml,%3C%3Fxml version='1.0' encoding='utf-8'%3F%3E%3Csvg width='800px' height='800px' viewBox='0 0 24 24' fill='none' xmlns='http://www.w3.org/2000/svg'%3E%3Cpath d='M3 5.25C3 4.00736 4.00736 3 5.25 3H18.75C19.9926 3 21 4.00736 21 5.25V12.0218C20.5368 11.7253 20.0335 11.4858 19.5 11.3135V5.25C19.5 4.83579 19.1642 4.5 18.75 4.5H5.25C4.83579 4.5 4.5 4.83579 4.5 5.25V18.75C4.5 19.1642 4.83579 19.5 5.25 19.5H11.3135C11.4858 20.0335 11.7253 20.5368 12.0218 21H5.25C4.00736 21 3 19.9926 3 18.75V5.25Z' fill='%23212121'/%3E%3Cpath d='M10.7803 7.71967C11.0732 8.01256 11.0732 8.48744 10.7803 8.78033L8.78033 10.7803C8.48744 11.0732 8.01256 11.0732 7.71967 10.7803L6.71967 9.78033C6.42678 9.48744 6.42678 9.01256 6.71967 8.71967C7.01256 8.42678 7.48744 8.42678 7.78033 8.71967L8.25 9.18934L9.71967 7.71967C10.0126 7.42678 10.4874 7.42678 10.7803 7.71967Z' fill='%23212121'/%3E%3Cpath d='M10.7803 13.2197C11.0732 13.5126 11.0732 13.9874 10.7803 14.2803L8.78033 16.2803C8.48744 16.5732 8.01256 16.5732 7.71967 16.2803L6.71967 15.2803C6.42678 14.9874 6.42678 14.5126 6.71967 14.2197C7.01256 13.9268 7.48744 13.9268 7.78033 14.2197L8.25 14.6893L9.71967 13.2197C10.0126 12.9268 10.4874 12.9268 10.7803 13.2197Z' fill='%23212121'/%3E%3Cpath d='M17.5 12C20.5376 12 23 14.4624 23 17.5C23 20.5376 20.5376 23 17.5 23C14.4624 23 12 20.5376 12 17.5C12 14.4624 14.4624 12 17.5 12ZM18.0011 20.5035L18.0006 18H20.503C20.7792 18 21.003 17.7762 21.003 17.5C21.003 17.2239 20.7792 17 20.503 17H18.0005L18 14.4993C18 14.2231 17.7761 13.9993 17.5 13.9993C17.2239 13.9993 17 14.2231 17 14.4993L17.0005 17H14.4961C14.22 17 13.9961 17.2239 13.9961 17.5C13.9961 17.7762 14.22 18 14.4961 18H17.0006L17.0011 20.5035C17.0011 20.7797 17.225 21.0035 17.5011 21.0035C17.7773 21.0035 18.0011 20.7797 18.0011 20.5035Z' fill='%23212121'/%3E%3Cpath d='M13.25 8.5C12.8358 8.5 12.5 8.83579 12.5 9.25C12.5 9.66421 12.8358 10 13.25 10H16.75C17.1642 10 17.5 9.66421 17.5 9.25C17.5 8.83579 17.1642 8.5 16.75 8.5H13.25Z' fill='%23212121'/%3E%3C/svg%3E`,
-	)
-	d2Writer.Write("vars", d2Vars)
-	d2Writer.Write(uuid.NewString(), fmt.Sprintf(`Legend {
-  **.style: {
-    font-size: 30
-    bold: true
-  }
-  near: top-center
-  style.3d: true
-  subLegend1: "" {
-    style.opacity: 0
-    grid-columns: 4
-    grid-rows: 2
-    icon1: Variable {
-      shape: image
-      icon: ${%s}
-    }
-    icon1Description: |md
-      Variables are passed to tasks
-    |
-    icon2: External Task {
-      shape: image
-      icon: ${%s}
-    }
-    icon2Description: |md
-      Tasks that can be called\
-      directly by the Task CLI tool.
-    |
-    icon3: Internal Task {
-      shape: image
-      icon: ${%s}
-    }
-    icon3Description: |md
-      Tasks that can NOT be called\
-      directly by the Task CLI tool.
-    |
-    icon4: Unknown Task {
-      shape: image
-      icon: ${%s}
-    }
-    icon4Description: |md
-      It is not possible to identify the origin of these\
-      tasks as they are
-      - a dynamically named task using template variable(s)\
-        **or**
-      - a task in another imported Taskfile
-    |
-    icon5: Included Taskfile {
-      shape: image
-      icon: ${%s}
-    }
-    icon5Description: |md
-      Container for tasks that are included from other Taskfiles
-    |
-  }
-  subLegend2: Silent Task {
-    style: {
-      fill: grey
-    }
-    description: |md
-      Tasks that do NOT print their template resolution (**silent: true**).
-      - This makes sure that **template resolution does not expose secret** variables
-      - There could be other, less important reasons why a template resolution is not printed to the screen
-    |
-  }
-}`, varIconName, externalTaskIconName, internalTaskIconName, unknownTaskIconName, includedTaskfileIconName))
+	iconSet, err := GetIconSet(options.IconSet, options.IconOverrides)
+	if err != nil {
+		return "", err
+	}
+	WriteD2Config(d2Writer, options)
+	if options.Sequence != "" {
+		if err := diagram.WriteSequenceDiagram(d2Writer, taskfile, options.Sequence, options.SequenceDepth); err != nil {
+			return "", err
+		}
+		return d2Writer.String(), nil
+	}
+	WriteIconVars(d2Writer, iconSet)
+	if options.Boards {
+		diagram.WriteBoards(d2Writer, taskfile, path)
+	} else {
+		diagram.WriteTaskfile(d2Writer, taskfile)
+	}
+	if options.Steps != "" {
+		if err := WriteExecutionSteps(d2Writer, taskfile, options.Steps); err != nil {
+			return "", err
+		}
+	}
+	diagram.WriteLegend(d2Writer)
+	WriteGlobalStyles(d2Writer)
+	return d2Writer.String(), nil
+}
+
+// WriteTaskfile writes the tasks of the Taskfile, with their calls and required variables.
+func (d *Diagram) WriteTaskfile(d2Writer *D2Writer, taskfile *Taskfile) {
+	d.includedTasks = make(map[string]map[string]struct{})
 	for _, include := range taskfile.GetIncludes() {
-		includesToIncludedTasks[include] = make(map[string]struct{})
+		d.includedTasks[include] = make(map[string]struct{})
+		d.markLegendEntry(includedTaskfileLegendEntry)
 		// d2Writer.Write(fmt.Sprintf("'%s'", include), fmt.Sprintf("%s {}", include))
 		d2Writer.Write(fmt.Sprintf("'%s'.icon", include), fmt.Sprintf("${%s}", includedTaskfileIconName))
+		if d.namespaceTaskfiles != nil {
+			// Board links are relative to the current board, _ being the root board
+			d2Writer.Write(fmt.Sprintf("'%s'.link", include), fmt.Sprintf("_.layers.%s", include))
+		}
 	}
 
 	// Tasks
 	for _, taskName := range slices.Sorted(maps.Keys(taskfile.Tasks)) {
 		task := taskfile.Tasks[taskName]
 		// d2Writer.Write(fmt.Sprintf("'%s'", taskName), "{}")
-		if task.Desc != "" || task.Summary != "" {
+		deferredCalls, deferredCmds := task.GetDefers()
+		prompts := task.GetPrompts()
+		if task.Desc != "" || task.Summary != "" || len(prompts) != 0 || len(deferredCmds) != 0 {
 			markdownText := ""
 			if task.Desc != "" {
 				markdownText += fmt.Sprintf("## Description\n%s\n", task.Desc)
@@ -350,18 +552,57 @@ func TaskfileToD2(taskfileYaml []byte) (string, error) {
 			if task.Summary != "" {
 				markdownText += fmt.Sprintf("## Summary\n%s\n", task.Summary)
 			}
+			if len(prompts) != 0 {
+				markdownText += "## Prompt\n"
+				for _, prompt := range prompts {
+					markdownText += fmt.Sprintf("- %s\n", prompt)
+				}
+			}
+			if len(deferredCmds) != 0 {
+				markdownText += "## Deferred\n"
+				for _, deferredCmd := range deferredCmds {
+					markdownText += fmt.Sprintf("- `%s`\n", deferredCmd)
+				}
+			}
 			d2Writer.Write(fmt.Sprintf("'%s'.Text", taskName), fmt.Sprintf("|md\n%s|", markdownText))
 		}
+		if task.Label != "" || len(task.Aliases) != 0 {
+			displayName := taskName
+			if task.Label != "" {
+				displayName = task.Label
+			}
+			if len(task.Aliases) != 0 {
+				displayName += fmt.Sprintf("\n(aliases: %s)", strings.Join(task.Aliases, ", "))
+			}
+			d2Writer.Write(fmt.Sprintf("'%s'.label", taskName), Quote(displayName))
+		}
+		if len(task.Platforms) != 0 {
+			d2Writer.Write(fmt.Sprintf("'%s'.Platforms", taskName), fmt.Sprintf("%s {shape: oval; style.fill: lightyellow}", Quote(strings.Join(task.Platforms, ", "))))
+		}
 		if task.Silent {
-			d2Writer.Write(fmt.Sprintf("'%s'.style.fill", taskName), "grey")
+			d.markLegendEntry(silentTaskLegendEntry)
+		}
+		if len(prompts) != 0 {
+			d.markLegendEntry(promptingTaskLegendEntry)
+			d2Writer.Write(fmt.Sprintf("'%s'.shape", taskName), "hexagon")
+		}
+		if task.Interactive {
+			d.markLegendEntry(interactiveTaskLegendEntry)
+			d2Writer.Write(fmt.Sprintf("'%s'.style.double-border", taskName), "true")
+		}
+		if len(deferredCalls) != 0 {
+			d.markLegendEntry(deferredCallLegendEntry)
 		}
 		var taskIcon string
 		if task.Internal {
+			d.markLegendEntry(internalTaskLegendEntry)
 			taskIcon = internalTaskIconName
 		} else {
+			d.markLegendEntry(externalTaskLegendEntry)
 			taskIcon = externalTaskIconName
 		}
 		d2Writer.Write(fmt.Sprintf("'%s'.icon", taskName), fmt.Sprintf("${%s}", taskIcon))
+		d.WriteTaskStyle(d2Writer, taskfile, taskName, taskName)
 
 		// Required variables
 		for _, requiredVar := range task.GetRequiredVars() {
@@ -369,22 +610,38 @@ func TaskfileToD2(taskfileYaml []byte) (string, error) {
 			if len(requiredVar.Enum) != 0 {
 				label = fmt.Sprintf("\"%s\\n[%s]\"", label, strings.Join(requiredVar.Enum, ", "))
 			}
+			d.markLegendEntry(varLegendEntry)
 			d2Writer.Write(fmt.Sprintf("'%s'", requiredVar.Name), fmt.Sprintf("%s {shape: image; icon: ${%s}}", label, varIconName))
-			d2Writer.Write(fmt.Sprintf("'%s' -> '%s'", requiredVar.Name, taskName), "required by")
+			d2Writer.Write(fmt.Sprintf("'%s' -> '%s'", requiredVar.Name, taskName), formatCallLabel([]string{RequiredVarEdge}, d.GetStyle(taskfile, RequiredVarEdge, taskName)))
 		}
 
 		// Dependency calls
 		for _, depCall := range task.GetDepCalls() {
-			EncapsulatePassedVars(d2Writer, taskName, &taskfile, depCall, "calls as dependency", "passed to {style {stroke-dash: 3; stroke: green}}")
+			d.WriteTaskCall(d2Writer, taskName, taskfile, &task, depCall, DependencyEdge, DependencyEdge)
 		}
 
 		// Internal task calls
 		var callCount uint
 		for _, taskCall := range task.GetCalls() {
 			callCount++
-			EncapsulatePassedVars(d2Writer, taskName, &taskfile, taskCall, fmt.Sprintf("calls (%v)", callCount), "passed to {style.stroke-dash: 3}")
+			d.WriteTaskCall(d2Writer, taskName, taskfile, &task, taskCall, CallEdge, fmt.Sprintf("calls (%v)", callCount))
+		}
+
+		// Deferred task calls
+		for _, deferredCall := range deferredCalls {
+			d.WriteTaskCall(d2Writer, taskName, taskfile, &task, deferredCall, DeferredCallEdge, DeferredCallEdge)
 		}
 	}
+	if d.options.VarsLayer {
+		d.WriteVarsLayer(d2Writer, taskfile)
+	}
+	if d.options.VarsProvenance {
+		WriteVarProvenanceAnnotations(d2Writer, taskfile, AnalyzeVarProvenance(taskfile))
+	}
+}
+
+// WriteGlobalStyles writes the styles applying to every task and edge of the board.
+func WriteGlobalStyles(d2Writer *D2Writer) {
 	d2Writer.Write("(** -> **)[*].style",
 		`{
   stroke-width: 4
@@ -392,23 +649,6 @@ func TaskfileToD2(taskfileYaml []byte) (string, error) {
   bold: true
 }`)
 
-	d2Writer.Write("(** -> **)[*]",
-		`{
-  &label: required by
-  style {
-    stroke: red
-    stroke-dash: 3
-  }
-}`)
-
-	d2Writer.Write("(** -> **)[*]",
-		`{
-  &label: calls as dependency
-  style {
-    stroke: green
-  }
-}`)
-
 	d2Writer.Write("*", `{
   !&shape: image
   style.bold: true
@@ -426,58 +666,210 @@ func TaskfileToD2(taskfileYaml []byte) (string, error) {
   style.font-size: 20
   style.bold: true
 }`)
-	return d2Writer.String(), nil
 }
 
-// ProcessIO processes the entire standard input as raw bytes using a handler function.
-// The handler function processes the whole input and returns the transformed bytes or an error.
-func ProcessIO(handler func([]byte) ([]byte, error)) error {
-	// Read the entire input from stdin into a byte slice
-	input, err := io.ReadAll(os.Stdin)
-	if err != nil {
-		return fmt.Errorf("error reading input: %w", err)
+// errNoInput is returned by SelectInput when there is no Taskfile to read.
+var errNoInput = errors.New("no input")
+
+// SelectInput returns the path of the Taskfile to read, "-" meaning the standard input.
+// The input is the first argument if there is one, then the standard input if it is redirected
+// or piped, then the Taskfile found by the --dir and --taskfile flags.
+func SelectInput(args []string) (string, error) {
+	if len(args) == 0 && taskfileDir == "" && taskfileFlag == "" {
+		// Check if stdin is connected to a terminal
+		stdinInfo, err := os.Stdin.Stat()
+		if err != nil {
+			return "", fmt.Errorf("error checking stdin: %w", err)
+		}
+		if stdinInfo.Mode()&os.ModeCharDevice == 0 {
+			return "-", nil
+		}
 	}
+	return SelectTaskfile(args)
+}
 
-	// Pass the entire input to the handler
-	processedData, err := handler(input)
-	if err != nil {
-		return fmt.Errorf("error processing input: %w", err)
+// SelectTaskfile returns the path of the Taskfile to read, for commands that need a file:
+// the first argument if there is one, otherwise the Taskfile found by the --dir and --taskfile flags.
+func SelectTaskfile(args []string) (string, error) {
+	if len(args) != 0 {
+		if taskfileDir != "" || taskfileFlag != "" {
+			return "", fmt.Errorf("--dir and --taskfile can not be used together with a Taskfile argument")
+		}
+		return args[0], nil
 	}
-	// Write the processed data to stdout
-	_, err = os.Stdout.Write(processedData)
-	if err != nil {
+	taskfilePath, err := FindTaskfile(taskfileDir, taskfileFlag)
+	if errors.Is(err, errTaskfileNotFound) && taskfileDir == "" && taskfileFlag == "" {
+		return "", errNoInput
+	}
+	return taskfilePath, err
+}
+
+// SelectOutput returns the path the diagram is written to, "-" meaning the standard output.
+// It is the --output flag or the second argument if given, otherwise the standard output
+// for the standard input, and the input path with the extension of the output format for files.
+func SelectOutput(inputPath string, args []string) (string, error) {
+	switch {
+	case outputPath != "" && len(args) >= 2:
+		return "", fmt.Errorf("--output can not be used together with an output argument")
+	case outputPath != "":
+		return outputPath, nil
+	case len(args) >= 2:
+		return args[1], nil
+	case inputPath == "-":
+		return "-", nil
+	}
+	return inputPath + "." + outputFormat, nil
+}
+
+// ReadTaskfile reads the Taskfile at path, "-" meaning the standard input.
+func ReadTaskfile(path string) ([]byte, error) {
+	if path == "-" {
+		input, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("error reading input: %w", err)
+		}
+		return input, nil
+	}
+	return os.ReadFile(path)
+}
+
+// WriteOutput writes the diagram to path, "-" meaning the standard output.
+func WriteOutput(path string, d2 string) error {
+	if path == "-" {
+		if _, err := os.Stdout.WriteString(d2); err != nil {
+			return fmt.Errorf("error writing output: %w", err)
+		}
+		return nil
+	}
+	if err := os.WriteFile(path, []byte(d2), 0o644); err != nil {
 		return fmt.Errorf("error writing output: %w", err)
 	}
 	return nil
 }
-func EncapsulatePassedVars(d2Writer *D2Writer, taskName string, taskfile *Taskfile, taskCall TaskCall, firstConnectionValue, secondConnectionValue string) {
+
+// WriteTaskCall writes the call of a task, annotating its `for` loop if it has one.
+// In expand loops mode, statically known iterations are written as separate calls.
+// kind is the edge kind of the call, selecting its style rules.
+func (d *Diagram) WriteTaskCall(d2Writer *D2Writer, taskName string, taskfile *Taskfile, task *Task, taskCall TaskCall, kind, label string) {
+	var platformLines []string
+	if len(taskCall.Platforms) != 0 {
+		platformLines = append(platformLines, fmt.Sprintf("on %s", strings.Join(taskCall.Platforms, ", ")))
+	}
+	loop := taskfile.GetLoop(task, taskCall.For)
+	if loop != nil && d.options.ExpandLoops && len(loop.Iterations) != 0 {
+		for i, expandedCall := range taskCall.ExpandLoop(loop) {
+			labelLines := append([]string{label, fmt.Sprintf("[%s]", formatIteration(loop.Iterations[i]))}, platformLines...)
+			d.writeResolvedTaskCall(d2Writer, taskName, taskfile, task, expandedCall, nil, kind, labelLines)
+		}
+		return
+	}
+	labelLines := []string{label}
+	if loop != nil {
+		labelLines = append(labelLines, loop.Label())
+	}
+	labelLines = append(labelLines, platformLines...)
+	d.writeResolvedTaskCall(d2Writer, taskName, taskfile, task, taskCall, loop, kind, labelLines)
+}
+
+// writeResolvedTaskCall writes the call of a task. A templated task name that can be resolved statically
+// is written as dashed possible calls to the tasks it may resolve to, instead of an unknown task.
+func (d *Diagram) writeResolvedTaskCall(d2Writer *D2Writer, taskName string, taskfile *Taskfile, task *Task, taskCall TaskCall, loop *Loop, kind string, labelLines []string) {
+	if strings.Contains(taskCall.TaskName, "{{") {
+		if candidates := taskfile.ResolveTemplatedTaskName(task, taskCall.TaskName, loop); len(candidates) != 0 {
+			for _, candidate := range candidates {
+				possibleCall := taskCall
+				possibleCall.TaskName = candidate
+				d.writeCanonicalTaskCall(d2Writer, taskName, taskfile, possibleCall, kind, append(labelLines, "possible call"), true)
+			}
+			return
+		}
+	}
+	d.writeCanonicalTaskCall(d2Writer, taskName, taskfile, taskCall, kind, labelLines, false)
+}
+
+// writeCanonicalTaskCall writes the call of a task, connecting calls by alias to the aliased task
+// and calls matching a wildcard task such as `start:*` to the wildcard task, with the captured values on the edge.
+// The edge gets the style of its kind and of the called task, dashed if it is only a possible call.
+func (d *Diagram) writeCanonicalTaskCall(d2Writer *D2Writer, taskName string, taskfile *Taskfile, taskCall TaskCall, kind string, labelLines []string, isPossibleCall bool) {
+	if calledTaskName, match, isLocalTask := taskfile.ResolveTaskName(taskCall.TaskName); isLocalTask {
+		taskCall.TaskName = calledTaskName
+		if match != nil {
+			labelLines = append(labelLines, fmt.Sprintf("MATCH=[%s]", strings.Join(match, ", ")))
+		}
+	}
+	edgeStyle := d.GetStyle(taskfile, kind, taskCall.TaskName)
+	callStyle := edgeStyle
+	if isPossibleCall {
+		callStyle = slices.Concat(edgeStyle, []string{"style.stroke-dash: 5"})
+	}
+	passedVarsStyle := slices.Concat(edgeStyle, []string{"style.stroke-dash: 3"})
+	d.EncapsulatePassedVars(d2Writer, taskName, taskfile, taskCall, formatCallLabel(labelLines, callStyle), formatCallLabel([]string{"passed to"}, passedVarsStyle))
+}
+
+// formatCallLabel returns the value of an edge with its label and style fields.
+// Multi-line labels are quoted.
+func formatCallLabel(labelLines []string, edgeStyle []string) string {
+	label := labelLines[0]
+	if len(labelLines) != 1 {
+		label = Quote(strings.Join(labelLines, "\n"))
+	}
+	if len(edgeStyle) == 0 {
+		return label
+	}
+	return fmt.Sprintf("%s {%s}", label, strings.Join(edgeStyle, "; "))
+}
+
+func (d *Diagram) EncapsulatePassedVars(d2Writer *D2Writer, taskName string, taskfile *Taskfile, taskCall TaskCall, firstConnectionValue, secondConnectionValue string) {
 	// colons are for Taskfile namespaces for includes.
 	// In the diagram it makes sense to place all included tasks into their parent Taskfile
 	// representation to clearly show their relationship.
-	calledD2TaskName := strings.ReplaceAll(taskCall.TaskName, ":", "'.'")
+	// Tasks of this Taskfile may contain colons as well (e.g. `start:*`), these are kept as is.
+	calledD2TaskName := taskfile.D2TaskName(taskCall.TaskName)
+	_, isLocalTask := taskfile.Tasks[taskCall.TaskName]
 	if len(taskCall.Vars) == 0 {
 		d2Writer.Write(fmt.Sprintf("'%s' -> '%s'", taskName, calledD2TaskName), firstConnectionValue)
 	} else {
-		passedVarsContainerUuid := uuid.NewString()
+		passedVarsContainerUuid := d2Writer.NewID()
 		d2Writer.Write(fmt.Sprintf("'%s' -> %s", taskName, passedVarsContainerUuid), firstConnectionValue)
 		d2Writer.Write(fmt.Sprintf("%s -> '%s'", passedVarsContainerUuid, calledD2TaskName), secondConnectionValue)
 		d2Writer.Write(passedVarsContainerUuid, "With {shape: parallelogram; style.stroke-dash: 3}")
 		for _, passedVar := range taskCall.Vars {
 			escaped := strings.NewReplacer("'", "\\'", "\"", "\\\"", "{", "\\{", "}", "\\}").Replace(fmt.Sprintf("%#v", passedVar.Value))
+			d.markLegendEntry(varLegendEntry)
 			d2Writer.Write(fmt.Sprintf("%s.'%s'", passedVarsContainerUuid, passedVar.Name), fmt.Sprintf("{shape: image; icon: ${%s}}", varIconName))
-			valueUuid := uuid.NewString()
+			valueUuid := d2Writer.NewID()
 			d2Writer.Write(fmt.Sprintf("%s.%s", passedVarsContainerUuid, valueUuid), fmt.Sprintf("%v {shape: text}", escaped))
 			d2Writer.Write(fmt.Sprintf("%s.'%s' -> %s.%s", passedVarsContainerUuid, passedVar.Name, passedVarsContainerUuid, valueUuid), "set to")
 		}
 	}
+	if isLocalTask {
+		return
+	}
 	if strings.Contains(taskCall.TaskName, ":") {
 		taskNameChunks := strings.SplitN(taskCall.TaskName, ":", 2)
-		includedTasks := includesToIncludedTasks[taskNameChunks[0]]
+		includedTasks := d.includedTasks[taskNameChunks[0]]
+		if includedTasks == nil {
+			includedTasks = make(map[string]struct{})
+			d.includedTasks[taskNameChunks[0]] = includedTasks
+		}
 		if _, alreadyHasIcon := includedTasks[taskNameChunks[1]]; !alreadyHasIcon {
 			includedTasks[taskNameChunks[1]] = struct{}{}
-			d2Writer.Write(fmt.Sprintf("'%s'.icon", calledD2TaskName), fmt.Sprintf("${%s}", unknownTaskIconName))
+			taskIcon := unknownTaskIconName
+			if includedTask, isKnownTask := d.getIncludedTask(taskNameChunks[0], taskNameChunks[1]); !isKnownTask {
+				d.markLegendEntry(unknownTaskLegendEntry)
+			} else if includedTask.Internal {
+				d.markLegendEntry(internalTaskLegendEntry)
+				taskIcon = internalTaskIconName
+			} else {
+				d.markLegendEntry(externalTaskLegendEntry)
+				taskIcon = externalTaskIconName
+			}
+			d2Writer.Write(fmt.Sprintf("'%s'.icon", calledD2TaskName), fmt.Sprintf("${%s}", taskIcon))
+			d.WriteTaskStyle(d2Writer, taskfile, calledD2TaskName, taskCall.TaskName)
 		}
-	} else if _, taskExists := taskfile.Tasks[calledD2TaskName]; !taskExists {
+	} else {
+		d.markLegendEntry(unknownTaskLegendEntry)
 		d2Writer.Write(fmt.Sprintf("'%s'.icon", calledD2TaskName), fmt.Sprintf("${%s}", unknownTaskIconName))
+		d.WriteTaskStyle(d2Writer, taskfile, calledD2TaskName, taskCall.TaskName)
 	}
 }
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTaskfileToD2(t *testing.T) {
+	const taskfileYaml = `
+version: '3'
+tasks:
+  build:
+    cmds: [go build]
+  lint:
+    internal: true
+  all:
+    deps: [lint]
+    cmds:
+      - task: build
+`
+	tests := []struct {
+		name       string
+		setOptions func(options *Options)
+		want       []string
+		notWant    []string
+	}{
+		{
+			name:    "defaults",
+			want:    []string{"'all' -> 'lint': calls as dependency {style.stroke: green}", "'all' -> 'build': calls (1)", "icon2: External Task", "icon3: Internal Task"},
+			notWant: []string{"icon1: Variable", "styleRule1", "vars.d2-config"},
+		},
+		{
+			name: "style rule",
+			setOptions: func(options *Options) {
+				options.Styles = []StyleRule{{Match: StyleMatch{Task: "b*"}, Style: Style{Fill: "orange"}}}
+			},
+			want: []string{"'build'.style.fill: orange", `styleRule1: "task b*"`},
+		},
+		{
+			name:       "exclude",
+			setOptions: func(options *Options) { options.Exclude = []string{"lint"} },
+			notWant:    []string{"'lint'"},
+		},
+		{
+			name:       "layout",
+			setOptions: func(options *Options) { options.Layout, options.Pad = "elk", 20 },
+			want:       []string{"vars.d2-config.layout-engine: elk", "vars.d2-config.pad: 20"},
+		},
+		{
+			name:       "no legend",
+			setOptions: func(options *Options) { options.Legend = LegendNone },
+			notWant:    []string{"Legend"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options := NewOptions()
+			if test.setOptions != nil {
+				test.setOptions(options)
+			}
+			d2, err := TaskfileToD2([]byte(taskfileYaml), "Taskfile.yml", options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range test.want {
+				if !strings.Contains(d2, want) {
+					t.Errorf("the diagram does not contain %q:\n%s", want, d2)
+				}
+			}
+			for _, notWant := range test.notWant {
+				if strings.Contains(d2, notWant) {
+					t.Errorf("the diagram contains %q:\n%s", notWant, d2)
+				}
+			}
+		})
+	}
+}
+
+func TestParseTaskfileMalformed(t *testing.T) {
+	tests := []struct {
+		name  string
+		tasks string
+		want  string
+	}{
+		{"nested dependency list", "build: {deps: [[x]]}", "task build: unsupported dependency: [x]"},
+		{"required variable without name", "build: {requires: {vars: [{enum: [a]}]}}", "task build: required variable without a name"},
+		{"required enum not a list", "build: {requires: {vars: [{name: ENV, enum: a}]}}", "task build: the enum of required variable ENV is not a list"},
+		{"unsupported required variable", "build: {requires: {vars: [[ENV]]}}", "task build: unsupported required variable: [ENV]"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseTaskfile([]byte("version: '3'\ntasks:\n  " + test.tasks + "\n"))
+			if err == nil || !strings.HasPrefix(err.Error(), test.want) {
+				t.Errorf("ParseTaskfile() error = %v, want %q", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+// Options are the settings of a diagram, from the command line flags and the configuration file.
+type Options struct {
+	// ExpandLoops draws one call per statically known iteration of for loops
+	ExpandLoops    bool
+	VarsLayer      bool
+	VarsProvenance bool
+	// Platform hides the tasks and commands that would not run on it, e.g. linux/amd64
+	Platform string
+	// Exclude hides the tasks matching the glob patterns, e.g. `docs:*`, and their calls
+	Exclude []string
+	// Revision is the git revision the included Taskfiles are read at, the working tree if empty
+	Revision string
+	// Layout is the D2 layout engine: dagre, elk or tala
+	Layout    string
+	Direction string
+	// Pad, GridGap and DarkTheme are not written in the diagram if negative
+	Pad         int
+	GridRows    int
+	GridColumns int
+	GridGap     int
+	Elk         map[string]string
+	Theme       int
+	DarkTheme   int
+	// IconSet is the name of the built-in icon set, with the icons of IconOverrides replaced
+	IconSet       string
+	IconOverrides IconSet
+	Legend        string
+	// Styles are the style rules of the configuration, applied after the default styles
+	Styles []StyleRule
+	// Boards draws an overview of the namespaces, linked to a board of their own for each namespace
+	Boards bool
+	// Steps is the task whose execution order is animated
+	Steps string
+	// Sequence is the task drawn as a sequence diagram instead of the graph, following SequenceDepth levels of calls
+	Sequence      string
+	SequenceDepth int
+}
+
+// NewOptions returns the default options, those of the flags that are not set.
+func NewOptions() *Options {
+	return &Options{
+		Pad:           -1,
+		GridGap:       -1,
+		DarkTheme:     -1,
+		IconSet:       "light",
+		Legend:        LegendAuto,
+		SequenceDepth: 3,
+	}
+}
+
+// IsMultiBoard reports whether the diagram has several boards: layers or steps.
+func (o *Options) IsMultiBoard() bool {
+	return o.Boards || o.Steps != "" || o.Legend == LegendSeparate
+}
+
+// diagramOptions holds the values of the diagram flags, see addDiagramFlags.
+var diagramOptions Options
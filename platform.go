@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// knownArchs are the architectures Task accepts in `platforms`, anything else is an operating system.
+var knownArchs = []string{"386", "amd64", "amd64p32", "arm", "arm64", "arm64be", "armbe", "loong64", "mips", "mips64", "mips64le", "mips64p32", "mips64p32le", "mipsle", "ppc", "ppc64", "ppc64le", "riscv", "riscv64", "s390", "s390x", "sparc", "sparc64", "wasm"}
+
+// Platform is an operating system and architecture pair such as linux/amd64.
+// An empty field matches any value.
+type Platform struct {
+	OS   string
+	Arch string
+}
+
+// ParsePlatform parses a platform given as "os/arch", "os" or "arch".
+func ParsePlatform(platform string) Platform {
+	if os, arch, hasArch := strings.Cut(platform, "/"); hasArch {
+		return Platform{OS: os, Arch: arch}
+	}
+	if slices.Contains(knownArchs, platform) {
+		return Platform{Arch: platform}
+	}
+	return Platform{OS: platform}
+}
+
+func (p Platform) String() string {
+	switch {
+	case p.OS == "":
+		return p.Arch
+	case p.Arch == "":
+		return p.OS
+	}
+	return fmt.Sprintf("%s/%s", p.OS, p.Arch)
+}
+
+// Runs reports whether a task or command with the given `platforms` runs on p.
+// An empty list runs on every platform.
+func (p Platform) Runs(platforms []string) bool {
+	if len(platforms) == 0 {
+		return true
+	}
+	for _, platform := range platforms {
+		required := ParsePlatform(platform)
+		osMatches := required.OS == "" || p.OS == "" || required.OS == p.OS
+		archMatches := required.Arch == "" || p.Arch == "" || required.Arch == p.Arch
+		if osMatches && archMatches {
+			return true
+		}
+	}
+	return false
+}
+
+// GetPlatforms returns the `platforms` of a command or dependency.
+func GetPlatforms(cmd map[string]any) (result []string) {
+	platforms, _ := cmd["platforms"].([]any)
+	for _, platform := range platforms {
+		result = append(result, fmt.Sprintf("%v", platform))
+	}
+	return
+}
+
+// FilterPlatform removes the tasks and commands that would not run on platform,
+// together with the calls of the removed tasks.
+func (tf *Taskfile) FilterPlatform(platform Platform) {
+	var removedTasks []string
+	for taskName, task := range tf.Tasks {
+		if !platform.Runs(task.Platforms) {
+			removedTasks = append(removedTasks, taskName)
+		}
+	}
+	isRemovedTask := func(calledTaskName string) bool {
+		resolvedTaskName, _, isLocalTask := tf.ResolveTaskName(calledTaskName)
+		return isLocalTask && slices.Contains(removedTasks, resolvedTaskName)
+	}
+	// Calls are resolved before removing the tasks, to tell the calls of removed tasks
+	// from the calls of tasks that were never defined, which are kept.
+	// Once removed, the tasks a templated name resolves to could be matched by a wildcard task instead.
+	tf.filterCalls(func(caller *Task, entry map[string]any) bool {
+		if !platform.Runs(GetPlatforms(entry)) {
+			return true
+		}
+		calledTaskName, isCall := entry["task"].(string)
+		if !isCall {
+			return false
+		}
+		if strings.Contains(calledTaskName, "{{") {
+			candidates := tf.ResolveTemplatedTaskName(caller, calledTaskName, tf.GetLoop(caller, entry["for"]))
+			if len(candidates) != 0 {
+				return !slices.ContainsFunc(candidates, func(candidate string) bool { return !isRemovedTask(candidate) })
+			}
+		}
+		return isRemovedTask(calledTaskName)
+	})
+	for _, taskName := range removedTasks {
+		delete(tf.Tasks, taskName)
+	}
+}
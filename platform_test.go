@@ -0,0 +1,49 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFilterPlatform(t *testing.T) {
+	const taskfileYaml = `
+version: '3'
+vars:
+  TARGET: linux
+tasks:
+  build-linux:
+    platforms: [linux]
+  build-*: {}
+  deploy:
+    cmds:
+      - task: build-{{.TARGET}}
+      - task: build-linux
+      - task: package
+      - cmd: echo windows only
+        platforms: [windows]
+`
+	tests := []struct {
+		platform string
+		want     []string
+	}{
+		{"linux", []string{"build-{{.TARGET}}", "build-linux", "package"}},
+		{"windows", []string{"package"}},
+	}
+	for _, test := range tests {
+		t.Run(test.platform, func(t *testing.T) {
+			taskfile, err := ParseTaskfile([]byte(taskfileYaml))
+			if err != nil {
+				t.Fatal(err)
+			}
+			taskfile.FilterPlatform(ParsePlatform(test.platform))
+			deploy := taskfile.Tasks["deploy"]
+			var got []string
+			for _, call := range deploy.GetCalls() {
+				got = append(got, call.TaskName)
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("the calls of deploy on %s are %q, want %q", test.platform, got, test.want)
+			}
+		})
+	}
+}
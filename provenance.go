@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Variable sources, in the order of Task's variable precedence.
+const (
+	TaskVarSource    = "task vars"
+	CallVarSource    = "passed by caller"
+	IncludeVarSource = "include vars"
+	GlobalVarSource  = "global vars"
+	EnvVarSource     = "global env"
+)
+
+type VarSource struct {
+	Kind string `json:"kind"`
+	// Origin is the calling task for CallVarSource and the namespace for IncludeVarSource.
+	Origin string `json:"origin,omitempty"`
+	Value  any    `json:"value"`
+}
+
+func (s VarSource) String() string {
+	if s.Origin == "" {
+		return fmt.Sprintf("%s (%s)", s.Kind, FormatVarValue(s.Value))
+	}
+	return fmt.Sprintf("%s %s (%s)", s.Kind, s.Origin, FormatVarValue(s.Value))
+}
+
+// VarProvenance lists the possible sources of a variable of a task.
+// The first source wins, the rest are shadowed by it.
+type VarProvenance struct {
+	Task    string      `json:"task"`
+	Name    string      `json:"name"`
+	Sources []VarSource `json:"sources"`
+}
+
+func (p VarProvenance) IsShadowed() bool {
+	return len(p.Sources) > 1
+}
+
+// SourcesString returns the sources from the winning to the most shadowed one.
+func (p VarProvenance) SourcesString() string {
+	var sources []string
+	for _, source := range p.Sources {
+		sources = append(sources, source.String())
+	}
+	return strings.Join(sources, " > ")
+}
+
+func (p VarProvenance) String() string {
+	return fmt.Sprintf("%s: %s", p.Name, p.SourcesString())
+}
+
+// defaultFuncRegexp matches a template action calling the default function,
+// piped as in '{{.X | default "y"}}' or called as in '{{default "y" .X}}'.
+var defaultFuncRegexp = regexp.MustCompile(`^\{\{-?\s*default\b|\|\s*default\b`)
+
+// isDefaultValue reports whether a task var only sets a default, e.g. '{{.X | default "y"}}',
+// in which case the value passed by the caller wins.
+func isDefaultValue(value any) bool {
+	stringValue, isString := value.(string)
+	if !isString {
+		return false
+	}
+	for _, action := range templateActionRegexp.FindAllString(stringValue, -1) {
+		if defaultFuncRegexp.MatchString(action) {
+			return true
+		}
+	}
+	return false
+}
+
+// AnalyzeVarProvenance computes the possible sources of every variable of every task,
+// including called tasks of included Taskfiles, in Task's precedence order:
+// task vars, vars passed by callers, include vars, global vars and global env.
+func AnalyzeVarProvenance(taskfile *Taskfile) (result []VarProvenance) {
+	callVars := make(map[string]map[string][]VarSource)
+	for _, callerName := range slices.Sorted(maps.Keys(taskfile.Tasks)) {
+		caller := taskfile.Tasks[callerName]
+		for _, call := range caller.GetAllCalls() {
+			if calledTaskName, _, isLocalTask := taskfile.ResolveTaskName(call.TaskName); isLocalTask {
+				call.TaskName = calledTaskName
+			}
+			if callVars[call.TaskName] == nil {
+				callVars[call.TaskName] = make(map[string][]VarSource)
+			}
+			for _, passedVar := range call.Vars {
+				callVars[call.TaskName][passedVar.Name] = append(callVars[call.TaskName][passedVar.Name], VarSource{
+					Kind:   CallVarSource,
+					Origin: callerName,
+					Value:  passedVar.Value,
+				})
+			}
+		}
+	}
+
+	taskNames := slices.Collect(maps.Keys(taskfile.Tasks))
+	for calledTaskName := range callVars {
+		if _, isLocalTask := taskfile.Tasks[calledTaskName]; !isLocalTask {
+			taskNames = append(taskNames, calledTaskName)
+		}
+	}
+	slices.Sort(taskNames)
+
+	for _, taskName := range taskNames {
+		task := taskfile.Tasks[taskName]
+		var includeVars map[string]any
+		namespace, _, isIncluded := strings.Cut(taskName, ":")
+		if isIncluded {
+			includeVars = taskfile.GetIncludeVars(namespace)
+		}
+
+		names := make(map[string]struct{})
+		for name := range task.Vars {
+			names[name] = struct{}{}
+		}
+		for name := range callVars[taskName] {
+			names[name] = struct{}{}
+		}
+		for name := range includeVars {
+			names[name] = struct{}{}
+		}
+		templateVars, _ := task.GetReferencedVars()
+		for _, requiredVar := range task.GetRequiredVars() {
+			templateVars = append(templateVars, requiredVar.Name)
+		}
+		for _, name := range templateVars {
+			_, isGlobalVar := taskfile.Vars[name]
+			_, isGlobalEnv := taskfile.Env[name]
+			if isGlobalVar || isGlobalEnv {
+				names[name] = struct{}{}
+			}
+		}
+
+		for _, name := range slices.Sorted(maps.Keys(names)) {
+			provenance := VarProvenance{Task: taskName, Name: name}
+			taskValue, isTaskVar := task.Vars[name]
+			if isTaskVar && !isDefaultValue(taskValue) {
+				provenance.Sources = append(provenance.Sources, VarSource{Kind: TaskVarSource, Value: taskValue})
+			}
+			provenance.Sources = append(provenance.Sources, callVars[taskName][name]...)
+			if isTaskVar && isDefaultValue(taskValue) {
+				provenance.Sources = append(provenance.Sources, VarSource{Kind: TaskVarSource, Value: taskValue})
+			}
+			if value, isIncludeVar := includeVars[name]; isIncludeVar {
+				provenance.Sources = append(provenance.Sources, VarSource{Kind: IncludeVarSource, Origin: namespace, Value: value})
+			}
+			if value, isGlobalVar := taskfile.Vars[name]; isGlobalVar {
+				provenance.Sources = append(provenance.Sources, VarSource{Kind: GlobalVarSource, Value: value})
+			}
+			if value, isGlobalEnv := taskfile.Env[name]; isGlobalEnv {
+				provenance.Sources = append(provenance.Sources, VarSource{Kind: EnvVarSource, Value: value})
+			}
+			result = append(result, provenance)
+		}
+	}
+	return
+}
+
+// WriteVarProvenanceReport writes the provenance of every variable, grouped by task.
+// Shadowed variables are flagged.
+func WriteVarProvenanceReport(w io.Writer, provenances []VarProvenance, asJSON bool) error {
+	if asJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(provenances)
+	}
+	var lastTask string
+	for _, provenance := range provenances {
+		if provenance.Task != lastTask {
+			if _, err := fmt.Fprintln(w, provenance.Task); err != nil {
+				return err
+			}
+			lastTask = provenance.Task
+		}
+		line := "  " + provenance.String()
+		if provenance.IsShadowed() {
+			line += " [shadowed]"
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteVarProvenanceAnnotations adds a note to every task with shadowed variables.
+func WriteVarProvenanceAnnotations(d2Writer *D2Writer, taskfile *Taskfile, provenances []VarProvenance) {
+	markdownTexts := make(map[string]string)
+	for _, provenance := range provenances {
+		if !provenance.IsShadowed() {
+			continue
+		}
+		markdownTexts[provenance.Task] += fmt.Sprintf("- **%s**: %s\n", provenance.Name, provenance.SourcesString())
+	}
+	for _, taskName := range slices.Sorted(maps.Keys(markdownTexts)) {
+		d2TaskName := taskName
+		if _, isLocalTask := taskfile.Tasks[taskName]; !isLocalTask {
+			d2TaskName = strings.ReplaceAll(taskName, ":", "'.'")
+		}
+		d2Writer.Write(fmt.Sprintf("'%s'.'Shadowed variables'", d2TaskName), fmt.Sprintf("|md\n## Shadowed variables\n%s|", markdownTexts[taskName]))
+	}
+}
+
+var varsReportAsJSON bool
+
+var varsCmd = &cobra.Command{
+	Use:   "vars [Taskfile.yml]",
+	Short: "Report the possible sources of every task variable in precedence order and flag shadowing",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		inputPath, err := SelectInput(args)
+		if errors.Is(err, errNoInput) {
+			return cmd.Help()
+		}
+		if err != nil {
+			return err
+		}
+		taskfileYaml, err := ReadTaskfile(inputPath)
+		if err != nil {
+			return err
+		}
+		taskfile, err := ParseTaskfile(taskfileYaml)
+		if err != nil {
+			return err
+		}
+		return WriteVarProvenanceReport(cmd.OutOrStdout(), AnalyzeVarProvenance(taskfile), varsReportAsJSON)
+	},
+}
+
+func init() {
+	varsCmd.Flags().BoolVar(&varsReportAsJSON, "json", false, "write the report as JSON")
+	rootCmd.AddCommand(varsCmd)
+}
@@ -0,0 +1,66 @@
+package main
+
+import "testing"
+
+func TestAnalyzeVarProvenance(t *testing.T) {
+	const taskfileYaml = `
+version: '3'
+includes:
+  docs:
+    taskfile: ./docs
+    vars:
+      FORMAT: pdf
+vars:
+  TARGET: linux
+  FORMAT: html
+  NAME: app
+env:
+  TARGET: darwin
+tasks:
+  build:
+    vars:
+      TARGET: windows
+      NAME: '{{.NAME | default "build"}}'
+      LABEL: '{{.TITLE}} (default build)'
+    cmds:
+      - echo {{.TARGET}} {{.NAME}} {{.LABEL}}
+  release:
+    vars:
+      OUTPUT: '{{default "dist" .OUTPUT}}'
+    cmds:
+      - task: build
+        vars:
+          TARGET: freebsd
+          NAME: release
+          LABEL: release
+      - task: docs:gen
+        vars:
+          FORMAT: epub
+`
+	taskfile, err := ParseTaskfile([]byte(taskfileYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	provenances := make(map[string]string)
+	for _, provenance := range AnalyzeVarProvenance(taskfile) {
+		provenances[provenance.Task+" "+provenance.Name] = provenance.SourcesString()
+	}
+	tests := []struct {
+		name     string
+		variable string
+		want     string
+	}{
+		{"task var shadows caller, global var and env", "build TARGET", "task vars (windows) > passed by caller release (freebsd) > global vars (linux) > global env (darwin)"},
+		{"caller shadows piped default", "build NAME", `passed by caller release (release) > task vars ({{.NAME | default "build"}}) > global vars (app)`},
+		{"default in the text is not a default", "build LABEL", "task vars ({{.TITLE}} (default build)) > passed by caller release (release)"},
+		{"called default", "release OUTPUT", `task vars ({{default "dist" .OUTPUT}})`},
+		{"caller shadows include vars", "docs:gen FORMAT", "passed by caller release (epub) > include vars docs (pdf) > global vars (html)"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := provenances[test.variable]; got != test.want {
+				t.Errorf("the sources of %s are %q, want %q", test.variable, got, test.want)
+			}
+		})
+	}
+}
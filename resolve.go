@@ -0,0 +1,64 @@
+package main
+
+import (
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ResolveTaskName returns the task of the Taskfile called as name.
+// Exact task names take precedence over aliases, and aliases over wildcard tasks such as `start:*`,
+// in which case match holds the values captured by the wildcards (the MATCH variable).
+// Names prefixed with an included namespace call the included Taskfile, never a wildcard task.
+func (tf *Taskfile) ResolveTaskName(name string) (taskName string, match []string, isLocalTask bool) {
+	if _, hasTask := tf.Tasks[name]; hasTask {
+		return name, nil, true
+	}
+	for _, taskName := range slices.Sorted(maps.Keys(tf.Tasks)) {
+		if slices.Contains(tf.Tasks[taskName].Aliases, name) {
+			return taskName, nil, true
+		}
+	}
+	if namespace, _, isIncluded := strings.Cut(name, ":"); isIncluded {
+		if _, hasInclude := tf.Includes[namespace]; hasInclude {
+			return "", nil, false
+		}
+	}
+	for _, pattern := range slices.Sorted(maps.Keys(tf.Tasks)) {
+		if !strings.Contains(pattern, "*") {
+			continue
+		}
+		if submatches := tf.getWildcardRegexp(pattern).FindStringSubmatch(name); submatches != nil {
+			return pattern, submatches[1:], true
+		}
+	}
+	return "", nil, false
+}
+
+// getWildcardRegexp returns the regexp matching the names called by the wildcard task pattern,
+// compiled on first use.
+func (tf *Taskfile) getWildcardRegexp(pattern string) *regexp.Regexp {
+	if tf.wildcardRegexps == nil {
+		tf.wildcardRegexps = make(map[string]*regexp.Regexp)
+	}
+	wildcardRegexp, isCompiled := tf.wildcardRegexps[pattern]
+	if !isCompiled {
+		wildcardRegexp = regexp.MustCompile("^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, "(.*)") + "$")
+		tf.wildcardRegexps[pattern] = wildcardRegexp
+	}
+	return wildcardRegexp
+}
+
+// HasTask reports whether name can be called from the Taskfile.
+// Tasks of included Taskfiles are assumed to exist if their namespace is included.
+func (tf *Taskfile) HasTask(name string) bool {
+	if _, _, isLocalTask := tf.ResolveTaskName(name); isLocalTask {
+		return true
+	}
+	if namespace, _, isIncluded := strings.Cut(name, ":"); isIncluded {
+		_, hasInclude := tf.Includes[namespace]
+		return hasInclude
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestResolveTaskName(t *testing.T) {
+	const taskfileYaml = `
+version: '3'
+includes:
+  docs: ./docs
+tasks:
+  build:
+    aliases: [b]
+  '*:*': {}
+`
+	taskfile, err := ParseTaskfile([]byte(taskfileYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name         string
+		call         string
+		wantTaskName string
+		wantMatch    []string
+		wantLocal    bool
+	}{
+		{"exact name", "build", "build", nil, true},
+		{"alias", "b", "build", nil, true},
+		{"wildcard", "test:unit", "*:*", []string{"test", "unit"}, true},
+		{"included namespace", "docs:gen", "", nil, false},
+		{"unknown task", "lint", "", nil, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			taskName, match, isLocalTask := taskfile.ResolveTaskName(test.call)
+			if taskName != test.wantTaskName || !slices.Equal(match, test.wantMatch) || isLocalTask != test.wantLocal {
+				t.Errorf("ResolveTaskName(%q) = %q, %q, %t, want %q, %q, %t", test.call, taskName, match, isLocalTask, test.wantTaskName, test.wantMatch, test.wantLocal)
+			}
+		})
+	}
+}
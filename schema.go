@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// visualizedTaskfileKeys and visualizedTaskKeys are the Taskfile and task attributes shown in the diagram.
+var (
+	visualizedTaskfileKeys = []string{"version", "includes", "vars", "env", "dotenv", "tasks"}
+	visualizedTaskKeys     = []string{"desc", "summary", "label", "prompt", "silent", "interactive", "internal", "requires", "aliases", "platforms", "vars", "env", "dotenv", "deps", "cmd", "cmds"}
+)
+
+// ParseVersion parses a Taskfile schema version such as 3, '3', '3.38' or '3.38.0'.
+func ParseVersion(version string) (major, minor, patch int, err error) {
+	parts := strings.Split(strings.TrimPrefix(strings.TrimSpace(version), "v"), ".")
+	if len(parts) > 3 {
+		return 0, 0, 0, fmt.Errorf("invalid Taskfile version %q", version)
+	}
+	numbers := make([]int, 3)
+	for i, part := range parts {
+		numbers[i], err = strconv.Atoi(part)
+		if err != nil || numbers[i] < 0 {
+			return 0, 0, 0, fmt.Errorf("invalid Taskfile version %q", version)
+		}
+	}
+	return numbers[0], numbers[1], numbers[2], nil
+}
+
+// CheckVersion returns an error unless version is a version 3 Taskfile schema.
+func CheckVersion(version string) error {
+	if version == "" {
+		return fmt.Errorf("the Taskfile has no version, only version 3 Taskfiles are supported")
+	}
+	major, _, _, err := ParseVersion(version)
+	if err != nil {
+		return err
+	}
+	if major != 3 {
+		return fmt.Errorf("Taskfile version %s is not supported, only version 3 Taskfiles are supported", version)
+	}
+	return nil
+}
+
+// GetUnvisualizedFeatures returns the Taskfile features present in the Taskfile that are not shown in the diagram,
+// e.g. "sources (used by build, test)".
+func GetUnvisualizedFeatures(taskfileYaml []byte) ([]string, error) {
+	var taskfile map[string]any
+	if err := yaml.Unmarshal(taskfileYaml, &taskfile); err != nil {
+		return nil, err
+	}
+	var result []string
+	for _, key := range slices.Sorted(maps.Keys(taskfile)) {
+		if !slices.Contains(visualizedTaskfileKeys, key) {
+			result = append(result, key)
+		}
+	}
+	featureUsers := make(map[string][]string)
+	tasks, _ := taskfile["tasks"].(map[string]any)
+	for _, taskName := range slices.Sorted(maps.Keys(tasks)) {
+		task, _ := tasks[taskName].(map[string]any)
+		for key := range task {
+			if !slices.Contains(visualizedTaskKeys, key) {
+				featureUsers[key] = append(featureUsers[key], taskName)
+			}
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(featureUsers)) {
+		result = append(result, fmt.Sprintf("%s (used by %s)", key, strings.Join(featureUsers[key], ", ")))
+	}
+	return result, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// sequenceWriter writes the messages of a sequence diagram, recording the actors they connect
+// in their order of appearance, since D2 only places the actors declared before the groups.
+type sequenceWriter struct {
+	diagram  *Diagram
+	taskfile *Taskfile
+	// ids is the writer of the diagram, giving unique keys to the groups
+	ids    *D2Writer
+	actors []string
+}
+
+func (s *sequenceWriter) addActor(taskName string) {
+	if !slices.Contains(s.actors, taskName) {
+		s.actors = append(s.actors, taskName)
+	}
+}
+
+// writeMessages writes the calls of taskCall by the task called taskName, one per run of the called task,
+// and the calls of the called task, as long as depth allows it.
+func (s *sequenceWriter) writeMessages(d2Writer *D2Writer, taskName string, task *Task, taskCall TaskCall, kind, label string, depth int, callers []string) {
+	loop := s.taskfile.GetLoop(task, taskCall.For)
+	for _, run := range s.taskfile.GetCallRuns(task, taskCall) {
+		calledTaskName := run.TaskName
+		labelLines := []string{label}
+		if resolvedTaskName, match, isLocalTask := s.taskfile.ResolveTaskName(calledTaskName); isLocalTask {
+			calledTaskName = resolvedTaskName
+			if match != nil {
+				labelLines = append(labelLines, fmt.Sprintf("MATCH=[%s]", strings.Join(match, ", ")))
+			}
+		}
+		if run.Iteration != nil {
+			labelLines = append(labelLines, fmt.Sprintf("[%s]", formatIteration(run.Iteration)))
+		} else if loop != nil {
+			labelLines = append(labelLines, loop.Label())
+		}
+		for _, passedVar := range taskCall.Vars {
+			labelLines = append(labelLines, fmt.Sprintf("%s=%v", passedVar.Name, passedVar.Value))
+		}
+		s.addActor(calledTaskName)
+		d2Writer.Write(fmt.Sprintf("'%s' -> '%s'", taskName, calledTaskName), formatCallLabel(labelLines, s.diagram.GetStyle(s.taskfile, kind, calledTaskName)))
+		s.writeCalls(d2Writer, calledTaskName, depth-1, callers)
+	}
+}
+
+// writeCalls writes the messages of the task called taskName: its dependencies in a group, as they
+// run in parallel, followed by its task calls in order. The calls of included and unknown tasks are
+// not known, nor the calls with templated names not resolving to a single task.
+func (s *sequenceWriter) writeCalls(d2Writer *D2Writer, taskName string, depth int, callers []string) {
+	task, isLocalTask := s.taskfile.Tasks[taskName]
+	if depth <= 0 || !isLocalTask || slices.Contains(callers, taskName) {
+		return
+	}
+	callers = append(callers, taskName)
+	depsWriter := NewD2Writer()
+	for _, depCall := range task.GetDepCalls() {
+		s.writeMessages(depsWriter, taskName, &task, depCall, DependencyEdge, DependencyEdge, depth, callers)
+	}
+	if len(depsWriter.data) != 0 {
+		d2Writer.Write(s.ids.NewID(), fmt.Sprintf("%s %s", Quote(fmt.Sprintf("dependencies of %s, in parallel", taskName)), depsWriter.Block()))
+	}
+	var callCount uint
+	for _, taskCall := range task.GetCalls() {
+		callCount++
+		s.writeMessages(d2Writer, taskName, &task, taskCall, CallEdge, fmt.Sprintf("calls (%v)", callCount), depth, callers)
+	}
+}
+
+// WriteSequenceDiagram writes a sequence diagram of the execution of the task called taskName,
+// following the calls of the called tasks up to depth levels.
+func (d *Diagram) WriteSequenceDiagram(d2Writer *D2Writer, taskfile *Taskfile, taskName string, depth int) error {
+	resolvedTaskName, _, isLocalTask := taskfile.ResolveTaskName(taskName)
+	if !isLocalTask {
+		return fmt.Errorf("unknown task %q to draw the sequence diagram of", taskName)
+	}
+	sequence := &sequenceWriter{diagram: d, taskfile: taskfile, ids: d2Writer}
+	sequence.addActor(resolvedTaskName)
+	messages := NewD2Writer()
+	sequence.writeCalls(messages, resolvedTaskName, depth, nil)
+	d2Writer.Write("shape", "sequence_diagram")
+	for _, actor := range sequence.actors {
+		d2Writer.Write(fmt.Sprintf("'%s'", actor))
+	}
+	if len(messages.data) != 0 {
+		d2Writer.Write(messages.String())
+	}
+	return nil
+}
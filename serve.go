@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	serveAddr string
+	d2Path    string
+)
+
+// animateInterval is the time each board of a multi-board diagram is shown in the rendered SVG, in milliseconds.
+const animateInterval = 1400
+
+// RenderSVG renders D2 source to SVG with the d2 executable, passing it the ELK options.
+// D2 can not write multi-board diagrams to the standard output, and writes them to a directory
+// of SVGs unless their boards are animated: the SVG is rendered into a temporary file, and the
+// boards of multi-board diagrams are animated in a single SVG.
+func RenderSVG(ctx context.Context, d2 string, options *Options) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "taskfile2d2-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	svgPath := filepath.Join(dir, "diagram.svg")
+	args := elkArgs(options.Elk)
+	if options.IsMultiBoard() {
+		args = append(args, fmt.Sprintf("--animate-interval=%d", animateInterval))
+	}
+	var stderr bytes.Buffer
+	render := exec.CommandContext(ctx, d2Path, slices.Concat(args, []string{"-", svgPath})...)
+	render.Stdin = strings.NewReader(d2)
+	render.Stderr = &stderr
+	if err := render.Run(); err != nil {
+		return nil, fmt.Errorf("error rendering with %s: %w\n%s", d2Path, err, stderr.String())
+	}
+	return os.ReadFile(svgPath)
+}
+
+// PreviewServer serves the latest rendering of a diagram and notifies browsers of updates with server-sent events.
+type PreviewServer struct {
+	mutex       sync.Mutex
+	svg         []byte
+	err         error
+	version     int
+	subscribers map[chan int]struct{}
+}
+
+func NewPreviewServer() *PreviewServer {
+	return &PreviewServer{subscribers: make(map[chan int]struct{})}
+}
+
+// Update replaces the served diagram, or the error preventing its rendering, and notifies the browsers.
+func (s *PreviewServer) Update(svg []byte, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.svg, s.err = svg, err
+	s.version++
+	for subscriber := range s.subscribers {
+		select {
+		case subscriber <- s.version:
+		default:
+			// The browser is still fetching a previous version, it will fetch the latest one
+		}
+	}
+}
+
+func (s *PreviewServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, previewPage)
+	case "/diagram.svg":
+		s.mutex.Lock()
+		svg, err := s.svg, s.err
+		s.mutex.Unlock()
+		if err != nil {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			fmt.Fprintf(w, "<pre>%s</pre>", html.EscapeString(err.Error()))
+			return
+		}
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Write(svg)
+	case "/events":
+		s.serveEvents(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *PreviewServer) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, canFlush := w.(http.Flusher)
+	if !canFlush {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	subscriber := make(chan int, 1)
+	s.mutex.Lock()
+	s.subscribers[subscriber] = struct{}{}
+	version := s.version
+	s.mutex.Unlock()
+	defer func() {
+		s.mutex.Lock()
+		delete(s.subscribers, subscriber)
+		s.mutex.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	for {
+		fmt.Fprintf(w, "data: %d\n\n", version)
+		flusher.Flush()
+		select {
+		case <-r.Context().Done():
+			return
+		case version = <-subscriber:
+		}
+	}
+}
+
+const previewPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>taskfile2d2</title>
+<style>
+  body { margin: 0; font-family: sans-serif; }
+  #diagram svg { width: 100vw; height: 100vh; }
+  #diagram pre { margin: 1em; color: darkred; white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<div id="diagram">Rendering...</div>
+<script>
+  const diagram = document.getElementById("diagram");
+  new EventSource("/events").onmessage = async () => {
+    const response = await fetch("/diagram.svg", {cache: "no-store"});
+    diagram.innerHTML = await response.text();
+  };
+</script>
+</body>
+</html>
+`
+
+var serveCmd = &cobra.Command{
+	Use:   "serve [Taskfile.yml]",
+	Short: "Serve a live preview of the diagram, re-rendered with D2 whenever the Taskfile changes",
+	Example: `# Open http://localhost:8080 in a browser to watch the diagram while editing the Taskfile
+taskfile2d2 serve Taskfile.yml
+
+# Using the ELK layout engine of a D2 installed outside of the PATH
+D2_LAYOUT=elk taskfile2d2 serve --d2 ~/bin/d2 --addr :9000`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		inputPath, err := SelectTaskfile(args)
+		if errors.Is(err, errNoInput) {
+			return cmd.Help()
+		}
+		if err != nil {
+			return err
+		}
+		options, err := LoadOptions(cmd, inputPath)
+		if err != nil {
+			return err
+		}
+		if _, err := exec.LookPath(d2Path); err != nil {
+			return fmt.Errorf("serve renders the diagram with D2, install it from https://d2lang.com: %w", err)
+		}
+
+		// The context is cancelled on Ctrl+C or when the server fails, then the rendering in progress
+		// is awaited so that its temporary directory is removed before exiting
+		ctx, cancel := context.WithCancel(cmd.Context())
+		previewServer := NewPreviewServer()
+		server := &http.Server{Addr: serveAddr, Handler: previewServer}
+		go func() {
+			<-ctx.Done()
+			server.Close()
+		}()
+		watchDone := make(chan struct{})
+		defer func() {
+			cancel()
+			<-watchDone
+		}()
+		go func() {
+			defer close(watchDone)
+			WatchTaskfile(ctx, inputPath, func() {
+				err := func() error {
+					taskfileYaml, err := ReadTaskfile(inputPath)
+					if err != nil {
+						return err
+					}
+					d2, err := TaskfileToD2(taskfileYaml, inputPath, options)
+					if err != nil {
+						return err
+					}
+					svg, err := RenderSVG(ctx, d2, options)
+					previewServer.Update(svg, err)
+					return err
+				}()
+				if err != nil && ctx.Err() == nil {
+					previewServer.Update(nil, err)
+					fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				}
+			})
+		}()
+		fmt.Fprintf(os.Stderr, "serving the diagram of %s on http://%s\n", inputPath, serveAddr)
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	},
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&serveAddr, "addr", "localhost:8080", "address to listen on")
+	serveCmd.Flags().StringVar(&d2Path, "d2", "d2", "path of the d2 executable used to render the diagram")
+	addDiagramFlags(serveCmd)
+	rootCmd.AddCommand(serveCmd)
+}
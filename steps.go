@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	// runningTaskColor is the label color of the tasks started in the current step
+	runningTaskColor = "#ff8f00"
+	// finishedTaskColor is the label color of the tasks started in the previous steps
+	finishedTaskColor = "#4caf50"
+)
+
+// D2TaskName returns the D2 key of the task called taskName in the diagram of the Taskfile,
+// included tasks being placed in the container of their namespace.
+func (tf *Taskfile) D2TaskName(taskName string) string {
+	if _, isLocalTask := tf.Tasks[taskName]; isLocalTask {
+		return taskName
+	}
+	return strings.ReplaceAll(taskName, ":", "'.'")
+}
+
+// SimulateExecution returns the tasks in the order Task starts them when running taskName, each step
+// holding the tasks started at the same time. The dependencies of a task run in parallel before it,
+// then the tasks called by its commands run in order, followed by its deferred calls in reverse order.
+// A looping call runs its task once per iteration, in parallel for dependencies. Included and unknown
+// tasks are not followed, and calls with templated names are skipped unless they resolve to a single task.
+func (tf *Taskfile) SimulateExecution(taskName string) [][]string {
+	return tf.simulateExecution(taskName, nil)
+}
+
+func (tf *Taskfile) simulateExecution(name string, callers []string) (steps [][]string) {
+	taskName, _, isLocalTask := tf.ResolveTaskName(name)
+	if !isLocalTask {
+		return [][]string{{name}}
+	}
+	if slices.Contains(callers, taskName) {
+		// Task would call itself forever, its first run is enough
+		return nil
+	}
+	callers = append(callers, taskName)
+	task := tf.Tasks[taskName]
+	for _, depCall := range task.GetDepCalls() {
+		for _, run := range tf.GetCallRuns(&task, depCall) {
+			for i, step := range tf.simulateExecution(run.TaskName, callers) {
+				if i == len(steps) {
+					steps = append(steps, nil)
+				}
+				for _, startedTask := range step {
+					if !slices.Contains(steps[i], startedTask) {
+						steps[i] = append(steps[i], startedTask)
+					}
+				}
+			}
+		}
+	}
+	steps = append(steps, []string{taskName})
+	for _, taskCall := range task.GetCalls() {
+		for _, run := range tf.GetCallRuns(&task, taskCall) {
+			steps = append(steps, tf.simulateExecution(run.TaskName, callers)...)
+		}
+	}
+	deferredCalls, _ := task.GetDefers()
+	for _, deferredCall := range slices.Backward(deferredCalls) {
+		for _, run := range tf.GetCallRuns(&task, deferredCall) {
+			steps = append(steps, tf.simulateExecution(run.TaskName, callers)...)
+		}
+	}
+	return
+}
+
+// WriteExecutionSteps writes the simulated execution of the task called taskName as D2 steps,
+// highlighting the tasks started in each step, with a caption listing them.
+// D2 renders steps into a directory of SVGs unless they are animated, which the diagram can not
+// configure: the D2 command animating them is written as a comment.
+func WriteExecutionSteps(d2Writer *D2Writer, taskfile *Taskfile, taskName string) error {
+	if _, _, isLocalTask := taskfile.ResolveTaskName(taskName); !isLocalTask {
+		return fmt.Errorf("unknown task %q to simulate", taskName)
+	}
+	d2Writer.Write(fmt.Sprintf("# Render as a single animated SVG: d2 --animate-interval=%d input.d2 output.svg", animateInterval))
+	captionID := d2Writer.NewID()
+	d2Writer.Write(captionID, fmt.Sprintf("%s {near: bottom-center}", Quote(fmt.Sprintf("Execution order of %s", taskName))))
+	var previousStep []string
+	for i, step := range taskfile.SimulateExecution(taskName) {
+		stepWriter := NewD2Writer()
+		for _, finishedTask := range previousStep {
+			if !slices.Contains(step, finishedTask) {
+				stepWriter.Write(fmt.Sprintf("'%s'.style.font-color", taskfile.D2TaskName(finishedTask)), Quote(finishedTaskColor))
+			}
+		}
+		for _, startedTask := range step {
+			stepWriter.Write(fmt.Sprintf("'%s'.style.font-color", taskfile.D2TaskName(startedTask)), Quote(runningTaskColor))
+		}
+		caption := fmt.Sprintf("%d. %s", i+1, strings.Join(step, ", "))
+		if len(step) != 1 {
+			caption += " (in parallel)"
+		}
+		stepWriter.Write(fmt.Sprintf("%s.label", captionID), Quote(caption))
+		d2Writer.Write(fmt.Sprintf("steps.'%s'", strconv.Itoa(i+1)), stepWriter.Block())
+		previousStep = step
+	}
+	return nil
+}
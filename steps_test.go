@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSimulateExecution(t *testing.T) {
+	const taskfileYaml = `
+version: '3'
+includes:
+  docs: ./docs
+vars:
+  TARGET: linux
+tasks:
+  lint: {}
+  test: {}
+  build-linux: {}
+  build-darwin: {}
+  cleanup: {}
+  package:
+    deps: [lint, test]
+  release:
+    deps: [lint]
+    cmds:
+      - defer: {task: cleanup}
+      - task: build-{{.TARGET}}
+      - task: package
+      - task: docs:gen
+      - task: deploy-{{.UNKNOWN}}
+  matrix:
+    deps:
+      - task: build-{{.ITEM}}
+        for: [linux, darwin]
+    cmds:
+      - task: lint
+        for: [a, b]
+      - task: build-{{.ITEM.OS}}
+        for:
+          matrix:
+            OS: [darwin]
+  loop:
+    cmds:
+      - task: loop
+      - task: test
+`
+	taskfile, err := ParseTaskfile([]byte(taskfileYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		taskName string
+		want     [][]string
+	}{
+		{"single task", "lint", [][]string{{"lint"}}},
+		{"parallel dependencies", "package", [][]string{{"lint", "test"}, {"package"}}},
+		{
+			name:     "calls in order, then deferred calls",
+			taskName: "release",
+			want:     [][]string{{"lint"}, {"release"}, {"build-linux"}, {"lint", "test"}, {"package"}, {"docs:gen"}, {"cleanup"}},
+		},
+		{
+			name:     "one run per iteration",
+			taskName: "matrix",
+			want:     [][]string{{"build-linux", "build-darwin"}, {"matrix"}, {"lint"}, {"lint"}, {"build-darwin"}},
+		},
+		{"recursive call", "loop", [][]string{{"loop"}, {"test"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := taskfile.SimulateExecution(test.taskName)
+			if fmt.Sprint(got) != fmt.Sprint(test.want) {
+				t.Errorf("SimulateExecution(%q) = %v, want %v", test.taskName, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// edgeKinds are the edge kinds style rules can match.
+var edgeKinds = []string{DependencyEdge, CallEdge, DeferredCallEdge, RequiredVarEdge}
+
+// Style holds the D2 style properties set by a style rule, unset properties are left unchanged.
+type Style struct {
+	Fill       string   `yaml:"fill"`
+	Stroke     string   `yaml:"stroke"`
+	StrokeDash *int     `yaml:"strokeDash"`
+	Shape      string   `yaml:"shape"`
+	Icon       string   `yaml:"icon"`
+	Opacity    *float64 `yaml:"opacity"`
+	Class      string   `yaml:"class"`
+}
+
+// StyleMatch selects the tasks, or the edges calling them, a style rule applies to.
+// Every set field must match.
+type StyleMatch struct {
+	// Task is a glob pattern of the task name, e.g. `deploy:*`
+	Task string `yaml:"task"`
+	// Namespace is the namespace of included tasks
+	Namespace string `yaml:"namespace"`
+	Internal  *bool  `yaml:"internal"`
+	Silent    *bool  `yaml:"silent"`
+	// Edge is the kind of the edges to style instead of the tasks, e.g. `calls as dependency`.
+	// The other fields then match the called task, or the task requiring a variable.
+	Edge string `yaml:"edge"`
+}
+
+// StyleRule sets the style of the tasks or edges it matches.
+type StyleRule struct {
+	Match StyleMatch `yaml:"match"`
+	Style Style      `yaml:"style"`
+	// Legend describes the rule in the legend, the match by default
+	Legend string `yaml:"legend"`
+}
+
+// defaultStyleRules are the styles of the diagram, applied before the style rules of the configuration.
+var defaultStyleRules = []StyleRule{
+	{Match: StyleMatch{Silent: newPointer(true)}, Style: Style{Fill: "grey"}},
+	{Match: StyleMatch{Edge: RequiredVarEdge}, Style: Style{Stroke: "red", StrokeDash: newPointer(3)}},
+	{Match: StyleMatch{Edge: DependencyEdge}, Style: Style{Stroke: "green"}},
+	{Match: StyleMatch{Edge: DeferredCallEdge}, Style: Style{Stroke: "purple", StrokeDash: newPointer(5)}},
+}
+
+func newPointer[T any](value T) *T {
+	return &value
+}
+
+// Validate checks that the rule matches a known edge kind with a valid task pattern,
+// and that edge rules only set properties of edges.
+func (r *StyleRule) Validate() error {
+	if _, err := path.Match(r.Match.Task, ""); err != nil {
+		return fmt.Errorf("invalid task pattern %q: %w", r.Match.Task, err)
+	}
+	if r.Match.Edge == "" {
+		return nil
+	}
+	if !slices.Contains(edgeKinds, r.Match.Edge) {
+		return fmt.Errorf("unknown edge kind %q, expected one of %s", r.Match.Edge, strings.Join(edgeKinds, ", "))
+	}
+	if r.Style.Fill != "" || r.Style.Shape != "" || r.Style.Icon != "" {
+		return fmt.Errorf("the rule of %s edges sets fill, shape or icon, which only apply to tasks", r.Match.Edge)
+	}
+	return nil
+}
+
+// Matches reports whether the rule applies to the task called taskName in the diagram,
+// or to the edges of the given kind leading to it if kind is not empty.
+// Flags only match the tasks of the Taskfile, the flags of included tasks are unknown.
+func (m *StyleMatch) Matches(taskfile *Taskfile, kind, taskName string) bool {
+	if m.Edge != kind {
+		return false
+	}
+	if m.Task != "" && !MatchTaskName(m.Task, taskName) {
+		return false
+	}
+	task, isLocalTask := taskfile.Tasks[taskName]
+	if m.Namespace != "" {
+		namespace, _, isIncluded := strings.Cut(taskName, ":")
+		if isLocalTask || !isIncluded || namespace != m.Namespace {
+			return false
+		}
+	}
+	if m.Internal != nil && (!isLocalTask || task.Internal != *m.Internal) {
+		return false
+	}
+	if m.Silent != nil && (!isLocalTask || task.Silent != *m.Silent) {
+		return false
+	}
+	return true
+}
+
+// String describes the tasks or edges matched, e.g. `calls edges to task deploy:*, internal`.
+func (m *StyleMatch) String() string {
+	var parts []string
+	if m.Task != "" {
+		parts = append(parts, fmt.Sprintf("task %s", m.Task))
+	}
+	if m.Namespace != "" {
+		parts = append(parts, fmt.Sprintf("namespace %s", m.Namespace))
+	}
+	describeFlag := func(flag *bool, set, unset string) {
+		if flag != nil && *flag {
+			parts = append(parts, set)
+		} else if flag != nil {
+			parts = append(parts, unset)
+		}
+	}
+	describeFlag(m.Internal, "internal", "external")
+	describeFlag(m.Silent, "silent", "not silent")
+	if m.Edge == "" {
+		if len(parts) == 0 {
+			return "all tasks"
+		}
+		return strings.Join(parts, ", ")
+	}
+	if len(parts) == 0 {
+		return fmt.Sprintf("%s edges", m.Edge)
+	}
+	return fmt.Sprintf("%s edges to %s", m.Edge, strings.Join(parts, ", "))
+}
+
+var plainStyleValueRegexp = regexp.MustCompile(`^[\w.-]+$`)
+
+// formatStyleValue quotes the value unless it is a plain word, so that colors such as #ff8f00 are not comments.
+func formatStyleValue(value string) string {
+	if plainStyleValueRegexp.MatchString(value) {
+		return value
+	}
+	return Quote(value)
+}
+
+// D2Fields returns the D2 fields setting the style, such as `style.fill: orange`.
+func (s *Style) D2Fields() (result []string) {
+	addField := func(key, value string) {
+		if value != "" {
+			result = append(result, fmt.Sprintf("%s: %s", key, formatStyleValue(value)))
+		}
+	}
+	addField("style.fill", s.Fill)
+	addField("style.stroke", s.Stroke)
+	if s.StrokeDash != nil {
+		addField("style.stroke-dash", strconv.Itoa(*s.StrokeDash))
+	}
+	addField("shape", s.Shape)
+	addField("icon", s.Icon)
+	if s.Opacity != nil {
+		addField("style.opacity", strconv.FormatFloat(*s.Opacity, 'f', -1, 64))
+	}
+	addField("class", s.Class)
+	return
+}
+
+// GetStyle returns the D2 fields of the default and configured style rules matching the task,
+// or the edges of the given kind leading to it. Later fields override earlier ones.
+// The configured rules that match are recorded for the legend.
+func (d *Diagram) GetStyle(taskfile *Taskfile, kind, taskName string) (result []string) {
+	for _, rule := range defaultStyleRules {
+		if rule.Match.Matches(taskfile, kind, taskName) {
+			result = append(result, rule.Style.D2Fields()...)
+		}
+	}
+	for i, rule := range d.options.Styles {
+		if rule.Match.Matches(taskfile, kind, taskName) {
+			d.markLegendEntry(styleRuleLegendEntry(i))
+			result = append(result, rule.Style.D2Fields()...)
+		}
+	}
+	return
+}
+
+// WriteTaskStyle writes the style of the task at the D2 key d2TaskName.
+func (d *Diagram) WriteTaskStyle(d2Writer *D2Writer, taskfile *Taskfile, d2TaskName, taskName string) {
+	for _, field := range d.GetStyle(taskfile, "", taskName) {
+		d2Writer.Write(fmt.Sprintf("'%s'.%s", d2TaskName, field))
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// templateFuncs is the subset of Task's template functions commonly used in task names.
+var templateFuncs = template.FuncMap{
+	"default": func(defaultValue, value any) any {
+		if value == nil || value == "" {
+			return defaultValue
+		}
+		return value
+	},
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"trim":       strings.TrimSpace,
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+}
+
+// GetKnownValues returns the statically known values a variable may have in the caller:
+// its literal task var, or else the enum of its requirement and its literal global var.
+// Task vars take precedence over global vars, so a global var is not a candidate if the task defines the var.
+func (tf *Taskfile) GetKnownValues(caller *Task, varName string) (result []any) {
+	isLiteral := func(value any) bool {
+		switch value := value.(type) {
+		case string:
+			return !strings.Contains(value, "{{")
+		case int, float64, bool:
+			return true
+		}
+		return false
+	}
+	value, isTaskVar := caller.Vars[varName]
+	if isTaskVar && isLiteral(value) {
+		return []any{value}
+	}
+	for _, requiredVar := range caller.GetRequiredVars() {
+		if requiredVar.Name == varName {
+			for _, enum := range requiredVar.Enum {
+				result = append(result, enum)
+			}
+		}
+	}
+	if value, isGlobalVar := tf.Vars[varName]; isGlobalVar && !isTaskVar && isLiteral(value) {
+		result = append(result, value)
+	}
+	return
+}
+
+// ResolveTemplatedTaskName evaluates the templated name of a task called by caller
+// with every combination of the statically known values of the variables it references,
+// including the iterations of the call's loop. It returns the existing tasks it may resolve to.
+// Names referencing a variable without known values, such as the iterations of a `sources` loop,
+// are not resolved: the called task is only known at runtime.
+func (tf *Taskfile) ResolveTemplatedTaskName(caller *Task, name string, loop *Loop) (result []string) {
+	nameTemplate, err := template.New("task").Funcs(templateFuncs).Option("missingkey=error").Parse(name)
+	if err != nil {
+		return nil
+	}
+
+	dataSets := []map[string]any{{}}
+	if loop != nil && len(loop.Iterations) != 0 {
+		dataSets = nil
+		for _, iteration := range loop.Iterations {
+			dataSets = append(dataSets, iterationData(iteration))
+		}
+	}
+	for _, action := range templateActionRegexp.FindAllString(name, -1) {
+		for _, match := range templateVarRegexp.FindAllStringSubmatch(action, -1) {
+			varName := match[1]
+			values := tf.GetKnownValues(caller, varName)
+			if len(values) == 0 || (loop != nil && varName == loop.As) {
+				continue
+			}
+			var product []map[string]any
+			for _, data := range dataSets {
+				if _, isSet := data[varName]; isSet {
+					product = append(product, data)
+					continue
+				}
+				for _, value := range values {
+					extended := make(map[string]any, len(data)+1)
+					for key, dataValue := range data {
+						extended[key] = dataValue
+					}
+					extended[varName] = value
+					product = append(product, extended)
+				}
+			}
+			dataSets = product
+		}
+	}
+
+	for _, data := range dataSets {
+		var resolved strings.Builder
+		if nameTemplate.Execute(&resolved, data) != nil {
+			continue
+		}
+		candidate := resolved.String()
+		if tf.HasTask(candidate) && !slices.Contains(result, candidate) {
+			result = append(result, candidate)
+		}
+	}
+	return
+}
+
+// iterationData returns the template data of a loop iteration,
+// nesting matrix variables such as ITEM.OS under ITEM.
+func iterationData(iteration []Variable) map[string]any {
+	data := make(map[string]any)
+	for _, variable := range iteration {
+		name, field, isField := strings.Cut(variable.Name, ".")
+		if !isField {
+			data[name] = variable.Value
+			continue
+		}
+		fields, _ := data[name].(map[string]any)
+		if fields == nil {
+			fields = make(map[string]any)
+			data[name] = fields
+		}
+		fields[field] = fmt.Sprintf("%v", variable.Value)
+	}
+	return data
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestResolveTemplatedTaskName(t *testing.T) {
+	const taskfileYaml = `
+version: '3'
+includes:
+  docs: ./docs
+vars:
+  TARGET: windows
+  FORMAT: html
+  PLATFORM: windows
+tasks:
+  build-linux: {}
+  build-windows: {}
+  build-darwin: {}
+  docs-html: {}
+  start:*: {}
+  caller:
+    vars:
+      TARGET: linux
+      PLATFORM: '{{.OTHER}}'
+    requires:
+      vars:
+        - name: ENV
+          enum: [linux, darwin]
+`
+	taskfile, err := ParseTaskfile([]byte(taskfileYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	caller := taskfile.Tasks["caller"]
+	tests := []struct {
+		name     string
+		taskName string
+		forValue any
+		want     []string
+	}{
+		{"task var", "build-{{.TARGET}}", nil, []string{"build-linux"}},
+		{"global var", "docs-{{.FORMAT}}", nil, []string{"docs-html"}},
+		{"required enum", "build-{{.ENV}}", nil, []string{"build-linux", "build-darwin"}},
+		{"template function", "build-{{.TARGET | upper | lower}}", nil, []string{"build-linux"}},
+		{"templated task var shadows global var", "build-{{.PLATFORM}}", nil, nil},
+		{"no existing task", "test-{{.TARGET}}", nil, nil},
+		{"unknown var in included namespace", "docs:{{.UNKNOWN}}", nil, nil},
+		{"unknown var matching wildcard task", "start:{{.NOPE}}", nil, nil},
+		{"loop items", "build-{{.ITEM}}", []any{"darwin", "windows"}, []string{"build-darwin", "build-windows"}},
+		{"loop over sources", "docs:{{.ITEM}}", "sources", nil},
+		{"matrix", "build-{{.ITEM.OS}}", map[string]any{"matrix": map[string]any{"OS": []any{"linux"}}}, []string{"build-linux"}},
+		{"unknown matrix field", "build-{{.ITEM.ARCH}}", map[string]any{"matrix": map[string]any{"OS": []any{"linux"}}}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := taskfile.ResolveTemplatedTaskName(&caller, test.taskName, taskfile.GetLoop(&caller, test.forValue))
+			if !slices.Equal(got, test.want) {
+				t.Errorf("ResolveTemplatedTaskName(%q) = %q, want %q", test.taskName, got, test.want)
+			}
+		})
+	}
+}
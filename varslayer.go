@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+)
+
+const configurationContainer = "Configuration"
+
+var (
+	templateActionRegexp = regexp.MustCompile(`\{\{.*?\}\}`)
+	// Matches .VAR but not the field access in .VAR.FIELD
+	templateVarRegexp = regexp.MustCompile(`(?:^|[^A-Za-z0-9_)\]])\.([A-Za-z_][A-Za-z0-9_]*)`)
+	shellVarRegexp    = regexp.MustCompile(`\$\{?([A-Za-z_][A-Za-z0-9_]*)`)
+)
+
+// GetCmdStrings returns the shell commands of the task, including deferred ones.
+func (t *Task) GetCmdStrings() (result []string) {
+	for _, cmd := range t.GetCmds() {
+		switch cmd := cmd.(type) {
+		case string:
+			result = append(result, cmd)
+		case map[string]any:
+			if shellCmd, isShellCmd := cmd["cmd"].(string); isShellCmd {
+				result = append(result, shellCmd)
+			}
+			if deferredCmd, isShellCmd := cmd["defer"].(string); isShellCmd {
+				result = append(result, deferredCmd)
+			}
+		}
+	}
+	return
+}
+
+// GetReferencedVars returns the names of template variables ({{.VAR}})
+// and environment variables ($VAR or ${VAR}) used in the task's commands.
+func (t *Task) GetReferencedVars() (templateVars, envVars []string) {
+	templateVarSet := make(map[string]struct{})
+	envVarSet := make(map[string]struct{})
+	for _, cmd := range t.GetCmdStrings() {
+		for _, action := range templateActionRegexp.FindAllString(cmd, -1) {
+			for _, match := range templateVarRegexp.FindAllStringSubmatch(action, -1) {
+				templateVarSet[match[1]] = struct{}{}
+			}
+		}
+		for _, match := range shellVarRegexp.FindAllStringSubmatch(templateActionRegexp.ReplaceAllString(cmd, ""), -1) {
+			envVarSet[match[1]] = struct{}{}
+		}
+	}
+	return slices.Sorted(maps.Keys(templateVarSet)), slices.Sorted(maps.Keys(envVarSet))
+}
+
+// FormatVarValue returns a human readable representation of a variable definition.
+func FormatVarValue(value any) string {
+	if dynamic, isMap := value.(map[string]any); isMap {
+		if sh, isSh := dynamic["sh"]; isSh {
+			return fmt.Sprintf("sh: %v", sh)
+		}
+		if ref, isRef := dynamic["ref"]; isRef {
+			return fmt.Sprintf("ref: %v", ref)
+		}
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// WriteVarsLayer writes the global and task level vars, env and dotenv files,
+// connected to the tasks defining or referencing them.
+func (d *Diagram) WriteVarsLayer(d2Writer *D2Writer, taskfile *Taskfile) {
+	d2Writer.Write(configurationContainer, "{style.stroke-dash: 3}")
+	writeVarNodes := func(prefix string, vars map[string]any, labelFormat string) {
+		for _, name := range slices.Sorted(maps.Keys(vars)) {
+			d.markLegendEntry(varLegendEntry)
+			d2Writer.Write(fmt.Sprintf("%s.'%s.%s'", configurationContainer, prefix, name),
+				fmt.Sprintf("%s {shape: image; icon: ${%s}; tooltip: %s}", Quote(fmt.Sprintf(labelFormat, name)), varIconName, Quote(FormatVarValue(vars[name]))))
+		}
+	}
+	writeDotenvNodes := func(prefix string, dotenv []string) {
+		for _, file := range dotenv {
+			d2Writer.Write(fmt.Sprintf("%s.'%s.%s'", configurationContainer, prefix, file), fmt.Sprintf("%s {shape: page}", Quote(file)))
+		}
+	}
+	writeVarNodes("vars", taskfile.Vars, "%s")
+	writeVarNodes("env", taskfile.Env, "$%s")
+	writeDotenvNodes("dotenv", taskfile.Dotenv)
+
+	for _, taskName := range slices.Sorted(maps.Keys(taskfile.Tasks)) {
+		task := taskfile.Tasks[taskName]
+		writeVarNodes(taskName+".vars", task.Vars, "%s")
+		writeVarNodes(taskName+".env", task.Env, "$%s")
+		writeDotenvNodes(taskName+".dotenv", task.Dotenv)
+		for _, name := range slices.Sorted(maps.Keys(task.Vars)) {
+			d2Writer.Write(fmt.Sprintf("%s.'%s.vars.%s' -> '%s'", configurationContainer, taskName, name, taskName), "defined in")
+		}
+		for _, name := range slices.Sorted(maps.Keys(task.Env)) {
+			d2Writer.Write(fmt.Sprintf("%s.'%s.env.%s' -> '%s'", configurationContainer, taskName, name, taskName), "defined in")
+		}
+		for _, file := range task.Dotenv {
+			d2Writer.Write(fmt.Sprintf("%s.'%s.dotenv.%s' -> '%s'", configurationContainer, taskName, file, taskName), "loaded by")
+		}
+
+		templateVars, envVars := task.GetReferencedVars()
+		for _, name := range templateVars {
+			_, isTaskVar := task.Vars[name]
+			if _, isGlobalVar := taskfile.Vars[name]; isGlobalVar && !isTaskVar {
+				d2Writer.Write(fmt.Sprintf("%s.'vars.%s' -> '%s'", configurationContainer, name, taskName), "referenced by")
+			}
+		}
+		for _, name := range envVars {
+			_, isTaskEnv := task.Env[name]
+			if _, isGlobalEnv := taskfile.Env[name]; isGlobalEnv && !isTaskEnv {
+				d2Writer.Write(fmt.Sprintf("%s.'env.%s' -> '%s'", configurationContainer, name, taskName), "referenced by")
+			}
+		}
+	}
+}
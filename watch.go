@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	watchInterval = 250 * time.Millisecond
+	// watchDebounce is how long the watched files must stay unchanged before regenerating,
+	// so that a burst of writes (e.g. an editor saving) triggers a single regeneration.
+	watchDebounce = 500 * time.Millisecond
+)
+
+// GetIncludePath returns the path of the Taskfile included under namespace, relative to dir.
+// It returns false for remote and templated includes, which can not be resolved locally.
+func (tf *Taskfile) GetIncludePath(dir, namespace string) (string, bool) {
+	var path string
+	switch include := tf.Includes[namespace].(type) {
+	case string:
+		path = include
+	case map[string]any:
+		path, _ = include["taskfile"].(string)
+	}
+	if path == "" || strings.Contains(path, "{{") || strings.Contains(path, "://") {
+		return "", false
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		if taskfilePath, found := findTaskfileIn(path); found {
+			return taskfilePath, true
+		}
+	}
+	return path, true
+}
+
+// GetIncludedTaskfiles returns the Taskfile at path and the local Taskfiles it includes, recursively.
+// Taskfiles that can not be read or parsed are returned without their includes.
+func GetIncludedTaskfiles(path string) []string {
+	paths := []string{path}
+	for i := 0; i < len(paths); i++ {
+		taskfileYaml, err := os.ReadFile(paths[i])
+		if err != nil {
+			continue
+		}
+		taskfile, err := ParseTaskfile(taskfileYaml)
+		if err != nil {
+			continue
+		}
+		for _, namespace := range slices.Sorted(maps.Keys(taskfile.Includes)) {
+			includePath, isLocal := taskfile.GetIncludePath(filepath.Dir(paths[i]), namespace)
+			if isLocal && !slices.Contains(paths, includePath) {
+				paths = append(paths, includePath)
+			}
+		}
+	}
+	return paths
+}
+
+// getModTimes returns the modification time of every file, zero for missing files.
+func getModTimes(paths []string) map[string]time.Time {
+	modTimes := make(map[string]time.Time)
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			modTimes[path] = info.ModTime()
+		} else {
+			modTimes[path] = time.Time{}
+		}
+	}
+	return modTimes
+}
+
+// WatchTaskfile calls regenerate once, then again whenever the Taskfile at path or one of
+// its included Taskfiles changed, until ctx is done.
+func WatchTaskfile(ctx context.Context, path string, regenerate func()) error {
+	regenerate()
+	modTimes := getModTimes(GetIncludedTaskfiles(path))
+	fmt.Fprintf(os.Stderr, "watching %d Taskfile(s), press Ctrl+C to stop\n", len(modTimes))
+	var lastChange time.Time
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			currentModTimes := getModTimes(GetIncludedTaskfiles(path))
+			if !maps.Equal(modTimes, currentModTimes) {
+				modTimes = currentModTimes
+				lastChange = now
+			} else if !lastChange.IsZero() && now.Sub(lastChange) >= watchDebounce {
+				lastChange = time.Time{}
+				regenerate()
+			}
+		}
+	}
+}